@@ -22,7 +22,8 @@ const _ = grpc.SupportPackageIsVersion7
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type PlayerProfileServiceClient interface {
-	// Creates a new profile for a registered user.
+	// Creates a new profile for a registered user. Profiles are created automatically from the
+	// auth service's user_registered events; this RPC is kept for backfilling existing users.
 	CreateProfile(ctx context.Context, in *CreateProfileRequest, opts ...grpc.CallOption) (*CreateProfileResponse, error)
 	// Retrieves a player's profile.
 	GetProfile(ctx context.Context, in *GetProfileRequest, opts ...grpc.CallOption) (*GetProfileResponse, error)
@@ -69,7 +70,8 @@ func (c *playerProfileServiceClient) UpdateProfile(ctx context.Context, in *Upda
 // All implementations must embed UnimplementedPlayerProfileServiceServer
 // for forward compatibility
 type PlayerProfileServiceServer interface {
-	// Creates a new profile for a registered user.
+	// Creates a new profile for a registered user. Profiles are created automatically from the
+	// auth service's user_registered events; this RPC is kept for backfilling existing users.
 	CreateProfile(context.Context, *CreateProfileRequest) (*CreateProfileResponse, error)
 	// Retrieves a player's profile.
 	GetProfile(context.Context, *GetProfileRequest) (*GetProfileResponse, error)
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/cheildo/nexus-clash-backend/internal/apigateway"
 	"github.com/cheildo/nexus-clash-backend/internal/auth"
 	"github.com/cheildo/nexus-clash-backend/internal/matchmaking" // Import matchmaking
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/events"
 	"github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
 	"github.com/cheildo/nexus-clash-backend/internal/pkg/redis" // Import redis
 	"github.com/cheildo/nexus-clash-backend/internal/playerprofile"
@@ -61,47 +63,154 @@ func main() {
 
 	// --- Connection Manager and Kafka Consumer Initialization ---
 	connManager := apigateway.NewConnectionManager()
+	// The gateway only decodes events, which accepts both wire formats.
+	codec := events.NewCodec(events.FormatJSON)
 	kafkaReader := kafka.NewConsumer(
 		viper.GetStringSlice("kafka.brokers"),
 		viper.GetString("kafka.match_found_topic"),
 		viper.GetString("kafka.consumer_group_id"),
 	)
-	matchmakingConsumer := apigateway.NewMatchmakingConsumer(kafkaReader, connManager)
+	// Messages that keep failing are moved to the dead-letter topic of their topic.
+	// Publishing waits for Kafka to acknowledge each write and retries failures, see kafka.Producer.
+	producerConfig := kafka.ProducerConfig{
+		Brokers:      viper.GetStringSlice("kafka.brokers"),
+		RequiredAcks: viper.GetString("kafka.producer.required_acks"),
+		MaxAttempts:  viper.GetInt("kafka.producer.max_attempts"),
+		MinBackoff:   viper.GetDuration("kafka.producer.min_backoff_ms") * time.Millisecond,
+		MaxBackoff:   viper.GetDuration("kafka.producer.max_backoff_seconds") * time.Second,
+		Timeout:      viper.GetDuration("kafka.producer.timeout_seconds") * time.Second,
+	}
+	deadLetters, err := kafka.NewDeadLetterProducer(producerConfig)
+	if err != nil {
+		slog.Error("Invalid Kafka producer configuration", "error", err)
+		os.Exit(1)
+	}
+	defer deadLetters.Close()
 
-	// Start the consumer in a background goroutine.
+	processedMatches := events.NewProcessedStore(rdb, viper.GetString("dedupe.key_prefix"), viper.GetDuration("dedupe.ttl_hours")*time.Hour)
+	matchmakingConsumer := apigateway.NewMatchmakingConsumer(codec, processedMatches, connManager)
+	matchmakingRunner := kafka.NewRunner(kafkaReader, deadLetters, matchmakingConsumer.HandleMessage, consumerConfig("api-gateway.match_found"))
+
+	// Sanctioned players are disconnected as soon as the auth service announces the sanction.
+	// Every gateway instance holds different WebSockets, so each reads every sanction in a group of its own.
+	sanctionReader := kafka.NewBroadcastConsumer(
+		viper.GetStringSlice("kafka.brokers"),
+		viper.GetString("kafka.account_sanction_topic"),
+		viper.GetString("kafka.sanction_consumer_group_prefix"),
+	)
+	sanctionConsumer := apigateway.NewSanctionConsumer(codec, grpcClients.Auth, connManager)
+	sanctionRunner := kafka.NewRunner(sanctionReader, deadLetters, sanctionConsumer.HandleMessage, consumerConfig("api-gateway.account_sanction"))
+
+	// Start the consumers in background goroutines.
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	go matchmakingConsumer.Run(ctx)
+	// Shutdown waits for the consumers to drain, see below.
+	var consumers sync.WaitGroup
+	for _, runner := range []*kafka.Runner{matchmakingRunner, sanctionRunner} {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			runner.Run(ctx)
+		}()
+	}
 
 	// --- HTTP Router and Middleware Setup ---
+	// The client IP is only taken from the X-Forwarded-For header of trusted proxies, since it
+	// keys the per-IP login limit.
+	trustedProxies, err := auth.ParseTrustedProxies(viper.GetStringSlice("http_server.trusted_proxies"))
+	if err != nil {
+		slog.Error("Invalid trusted proxies", "error", err)
+		os.Exit(1)
+	}
+
 	r := chi.NewRouter()
 	// ... (middleware setup remains the same) ...
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(trustedProxies.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(60 * time.Second))
 
 	// --- Route Definitions ---
-	// Instantiate the matchmaking pool, which will be shared with the WebSocket handler.
-	matchmakingPool := matchmaking.NewPool(rdb, viper.GetString("matchmaking.pool_key"))
+	// Instantiate the matchmaking pools, one per queue mode, which will be shared with the WebSocket handler.
+	// The gateway only adds and removes players; matches are formed by the matchmaking service, so
+	// the pools need no outbox.
+	matchmakingPools := map[string]matchmaking.Pool{
+		matchmaking.ModeCasual: matchmaking.NewPool(rdb, viper.GetString("matchmaking.pool_key"), nil),
+		matchmaking.ModeRanked: matchmaking.NewPool(rdb, viper.GetString("matchmaking.ranked_pool_key"), nil),
+	}
 
 	// Instantiate all our HTTP handlers.
 	authHandler := auth.NewHTTPHandler(grpcClients.Auth)
+	authMiddleware := auth.NewMiddleware(grpcClients.Auth)
 	profileHandler := playerprofile.NewHTTPHandler(grpcClients.PlayerProfile)
-	matchmakingHandler := matchmaking.NewWebsocketHandler(matchmakingPool, connManager) // Create the new WebSocket handler
+	exportHandler := apigateway.NewExportHandler(grpcClients.Auth, grpcClients.PlayerProfile)
+	matchmakingHandler := matchmaking.NewWebsocketHandler(matchmakingPools, connManager, grpcClients.Auth) // Create the new WebSocket handler
+
+	// Public signing keys, for services that verify session tokens locally.
+	r.Get("/.well-known/jwks.json", authHandler.HandleJWKS)
 
 	r.Route("/api/v1", func(r chi.Router) {
 		// Auth routes
 		r.Post("/auth/register", authHandler.HandleRegister)
 		r.Post("/auth/login", authHandler.HandleLogin)
+		r.Post("/auth/login/second-factor", authHandler.HandleVerifySecondFactor)
+		r.Post("/auth/guest", authHandler.HandleCreateGuest)
+		r.Post("/auth/guest/login", authHandler.HandleLoginGuest)
+		r.Post("/auth/refresh", authHandler.HandleRefresh)
+		r.Post("/auth/verify-email", authHandler.HandleVerifyEmail)
+		r.Get("/auth/oidc/{provider}/login", authHandler.HandleFederatedLogin)
+		r.Get("/auth/oidc/{provider}/callback", authHandler.HandleFederatedCallback)
+		r.Post("/auth/password/forgot", authHandler.HandleRequestPasswordReset)
+		r.Post("/auth/password/reset", authHandler.HandleResetPassword)
+
+		// Everything below requires a valid session token.
+		r.Group(func(r chi.Router) {
+			r.Use(authMiddleware.Authenticate)
+
+			// Session management routes
+			r.Post("/auth/logout", authHandler.HandleLogout)
+			r.Post("/auth/sessions/revoke-all", authHandler.HandleRevokeAllSessions)
+			r.Post("/auth/verify-email/resend", authHandler.HandleResendVerificationEmail)
+			r.Post("/auth/password/change", authHandler.HandleChangePassword)
+			r.Post("/auth/guest/upgrade", authHandler.HandleUpgradeGuest)
+			r.Post("/auth/totp/enroll", authHandler.HandleEnrollTOTP)
+			r.Post("/auth/totp/confirm", authHandler.HandleConfirmTOTP)
+			r.Post("/auth/totp/disable", authHandler.HandleDisableTOTP)
+			r.Post("/auth/identities/{provider}/start", authHandler.HandleStartLinkIdentity)
+			r.Post("/auth/identities/{provider}", authHandler.HandleLinkIdentity)
+
+			// Account data routes
+			r.Post("/account/delete", authHandler.HandleDeleteAccount)
+			r.Get("/account/export", exportHandler.HandleExport)
+
+			// Player Profile routes
+			r.Get("/profiles/{userID}", profileHandler.HandleGetProfile)
+			r.Patch("/profiles/{userID}", profileHandler.HandleUpdateProfile)
+
+			// Admin routes, for staff only. Moderators can look players up; changing data requires an admin.
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(auth.RequireRole(auth.RoleModerator, auth.RoleAdmin))
 
-		// Player Profile routes
-		r.Get("/profiles/{userID}", profileHandler.HandleGetProfile)
+				r.Get("/profiles/{userID}", profileHandler.HandleGetProfile)
+				r.Post("/users/{userID}/ban", authHandler.HandleBanAccount)
+				r.Delete("/users/{userID}/ban", authHandler.HandleLiftBan)
 
-		// Matchmaking WebSocket route
-		// Use .Handle() for WebSocket handlers as it supports the GET request used for the upgrade.
-		r.Handle("/matchmaking/find", matchmakingHandler)
+				r.Group(func(r chi.Router) {
+					r.Use(auth.RequireRole(auth.RoleAdmin))
+
+					r.Patch("/profiles/{userID}", profileHandler.HandleAdminUpdateProfile)
+					r.Post("/users/{userID}/roles", authHandler.HandleGrantRole)
+					r.Delete("/users/{userID}/roles/{role}", authHandler.HandleRevokeRole)
+				})
+			})
+
+			// Matchmaking WebSocket route
+			// Use .Handle() for WebSocket handlers as it supports the GET request used for the upgrade.
+			// The player is identified by the token, passed as a bearer header or "access_token" query parameter.
+			// The "mode" query parameter selects the casual (default) or ranked queue.
+			r.Handle("/matchmaking/find", matchmakingHandler)
+		})
 	})
 
 	slog.Info("All routes initialized.")
@@ -132,5 +241,21 @@ func main() {
 		slog.Error("Server forced to shutdown:", "error", err)
 	}
 
+	// Events being handled are finished and committed before exiting.
+	cancel()
+	consumers.Wait()
+
 	slog.Info("API Gateway server stopped.")
 }
+
+// consumerConfig returns the retry settings of a Kafka consumer.
+func consumerConfig(name string) kafka.RunnerConfig {
+	return kafka.RunnerConfig{
+		Name:         name,
+		MaxAttempts:  viper.GetInt("kafka.consumer.max_attempts"),
+		MinBackoff:   viper.GetDuration("kafka.consumer.min_backoff_ms") * time.Millisecond,
+		MaxBackoff:   viper.GetDuration("kafka.consumer.max_backoff_seconds") * time.Second,
+		Concurrency:  viper.GetInt("kafka.consumer.concurrency_per_partition"),
+		DrainTimeout: viper.GetDuration("kafka.consumer.drain_timeout_seconds") * time.Second,
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net"
@@ -19,6 +20,11 @@ import (
 	// Internal packages
 	"github.com/cheildo/nexus-clash-backend/internal/auth"
 	"github.com/cheildo/nexus-clash-backend/internal/pkg/database"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/email"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/events"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/outbox"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/redis"
 
 	// Proto-generated code
 	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
@@ -35,6 +41,28 @@ func startDiagnosticsServer(port string) {
 	}()
 }
 
+// loadOIDCProviders reads the identity providers configured under "oidc.providers", keyed by name.
+func loadOIDCProviders() []auth.OIDCProviderConfig {
+	var providers []auth.OIDCProviderConfig
+	for name := range viper.GetStringMap("oidc.providers") {
+		key := "oidc.providers." + name
+		providers = append(providers, auth.OIDCProviderConfig{
+			Name:             name,
+			Issuer:           viper.GetString(key + ".issuer"),
+			ClientID:         viper.GetString(key + ".client_id"),
+			ClientSecret:     viper.GetString(key + ".client_secret"),
+			AuthorizationURL: viper.GetString(key + ".authorization_url"),
+			TokenURL:         viper.GetString(key + ".token_url"),
+			JWKSURL:          viper.GetString(key + ".jwks_url"),
+			RedirectURL:      viper.GetString(key + ".redirect_url"),
+			LinkRedirectURL:  viper.GetString(key + ".link_redirect_url"),
+			Scopes:           viper.GetStringSlice(key + ".scopes"),
+		})
+		slog.Info("Configured identity provider", "provider", name)
+	}
+	return providers
+}
+
 func main() {
 	// --- Configuration Loading using Viper ---
 	// Viper is a popular library for handling application configuration from files, env vars, etc.
@@ -66,17 +94,187 @@ func main() {
 	defer db.Close()
 	slog.Info("Database connection successful.")
 
+	// --- Redis Connection for the session denylist and login rate limiting ---
+	redisCfg := redis.Config{
+		Addr:     viper.GetString("redis.addr"),
+		Password: viper.GetString("redis.password"),
+		DB:       viper.GetInt("redis.db"),
+	}
+	rdb, err := redis.NewClient(redisCfg)
+	if err != nil {
+		slog.Error("Failed to connect to Redis", "error", err)
+		os.Exit(1)
+	}
+	defer rdb.Close()
+	slog.Info("Redis connection successful.")
+
 	// --- Dependency Injection ---
-	repo := auth.NewRepository(db)
+	eventFormat, err := events.ParseFormat(viper.GetString("kafka.event_format"))
+	if err != nil {
+		slog.Error("Invalid event format", "error", err)
+		os.Exit(1)
+	}
+	codec := events.NewCodec(eventFormat)
+	repo := auth.NewRepository(db, auth.EventTopics{
+		UserRegistered:    viper.GetString("kafka.user_registered_topic"),
+		AccountSanctioned: viper.GetString("kafka.account_sanction_topic"),
+		AccountDeleted:    viper.GetString("kafka.account_deleted_topic"),
+	}, codec)
+	sessionStore := auth.NewSessionStore(rdb)
 
 	// Create the service config by pulling values from Viper.
 	svcConfig := auth.Config{
-		JWTSecret:     viper.GetString("jwt.secret_key"),
-		TokenDuration: viper.GetDuration("jwt.token_duration_minutes") * time.Minute,
+		TokenDuration:        viper.GetDuration("jwt.token_duration_minutes") * time.Minute,
+		RefreshTokenDuration: viper.GetDuration("jwt.refresh_token_duration_hours") * time.Hour,
+
+		VerificationTokenDuration: viper.GetDuration("email.verification_token_ttl_hours") * time.Hour,
+		VerificationURL:           viper.GetString("email.verification_url"),
+
+		PasswordResetTokenDuration: viper.GetDuration("email.password_reset_token_ttl_minutes") * time.Minute,
+		PasswordResetURL:           viper.GetString("email.password_reset_url"),
+
+		TOTPIssuer:                    viper.GetString("two_factor.issuer"),
+		SecondFactorChallengeDuration: viper.GetDuration("two_factor.challenge_ttl_minutes") * time.Minute,
+
+		OIDCProviders:         loadOIDCProviders(),
+		FederatedFlowDuration: viper.GetDuration("oidc.flow_ttl_minutes") * time.Minute,
+
+		AccountDeletionGracePeriod: viper.GetDuration("account_deletion.grace_period_days") * 24 * time.Hour,
+	}
+
+	keyConfig := auth.KeyConfig{
+		Algorithm:        viper.GetString("jwt.algorithm"),
+		RotationInterval: viper.GetDuration("jwt.key_rotation_hours") * time.Hour,
+		RetentionPeriod:  viper.GetDuration("jwt.key_retention_hours") * time.Hour,
+		RefreshInterval:  viper.GetDuration("jwt.key_refresh_minutes") * time.Minute,
+	}
+	// A retired key must stay published for as long as the tokens it signed can be used,
+	// which includes the links sent by email.
+	for _, lifetime := range []time.Duration{svcConfig.TokenDuration, svcConfig.VerificationTokenDuration, svcConfig.PasswordResetTokenDuration, svcConfig.SecondFactorChallengeDuration, svcConfig.FederatedFlowDuration} {
+		if keyConfig.RetentionPeriod < lifetime {
+			slog.Error("jwt.key_retention_hours must be at least the lifetime of every signed token", "lifetime", lifetime)
+			os.Exit(1)
+		}
+	}
+
+	keyManager, err := auth.NewKeyManager(repo, keyConfig)
+	if err != nil {
+		slog.Error("Failed to create signing key manager", "error", err)
+		os.Exit(1)
 	}
 
-	svc := auth.NewService(repo, svcConfig)
-	grpcHandler := auth.NewGRPCHandler(svc)
+	// The key manager rotates keys in the background until shutdown.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := keyManager.Start(ctx); err != nil {
+		slog.Error("Failed to load signing keys", "error", err)
+		os.Exit(1)
+	}
+
+	// Deleted accounts are purged in the background once their grace period has passed.
+	accountPurger := auth.NewAccountPurger(repo, svcConfig.AccountDeletionGracePeriod,
+		viper.GetDuration("account_deletion.purge_interval_minutes")*time.Minute)
+	accountPurger.Start(ctx)
+
+	loginLimiter := auth.NewLoginLimiter(rdb, auth.LoginLimiterConfig{
+		Window:             viper.GetDuration("login_protection.window_minutes") * time.Minute,
+		MaxAccountFailures: viper.GetInt("login_protection.max_account_failures"),
+		MaxIPFailures:      viper.GetInt("login_protection.max_ip_failures"),
+		BaseLockout:        viper.GetDuration("login_protection.base_lockout_seconds") * time.Second,
+		MaxLockout:         viper.GetDuration("login_protection.max_lockout_minutes") * time.Minute,
+	})
+
+	mailer, err := email.NewSender(email.Config{
+		Provider: viper.GetString("email.provider"),
+		From:     viper.GetString("email.from"),
+		FileDir:  viper.GetString("email.file_dir"),
+		SMTP: email.SMTPConfig{
+			Host:     viper.GetString("email.smtp.host"),
+			Port:     viper.GetString("email.smtp.port"),
+			Username: viper.GetString("email.smtp.username"),
+			Password: viper.GetString("email.smtp.password"),
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to create email sender", "error", err)
+		os.Exit(1)
+	}
+
+	passwordHasher := auth.NewPasswordHasher(auth.Argon2idParams{
+		Memory:      uint32(viper.GetUint("password_hashing.memory_kib")),
+		Iterations:  uint32(viper.GetUint("password_hashing.iterations")),
+		Parallelism: uint8(viper.GetUint("password_hashing.parallelism")),
+		SaltLength:  auth.DefaultArgon2idParams.SaltLength,
+		KeyLength:   auth.DefaultArgon2idParams.KeyLength,
+	})
+
+	// --- Outbox Relay Initialization ---
+	// Events are written to the outbox together with the change they announce: new and deleted
+	// accounts, so that the player-profile service creates or anonymizes their profiles, and
+	// sanctions, so that the gateway drops the player's live connections. The relay publishes them to Kafka.
+	// Publishing waits for Kafka to acknowledge each write and retries failures, see kafka.Producer.
+	producerConfig := kafka.ProducerConfig{
+		Brokers:      viper.GetStringSlice("kafka.brokers"),
+		RequiredAcks: viper.GetString("kafka.producer.required_acks"),
+		MaxAttempts:  viper.GetInt("kafka.producer.max_attempts"),
+		MinBackoff:   viper.GetDuration("kafka.producer.min_backoff_ms") * time.Millisecond,
+		MaxBackoff:   viper.GetDuration("kafka.producer.max_backoff_seconds") * time.Second,
+		Timeout:      viper.GetDuration("kafka.producer.timeout_seconds") * time.Second,
+	}
+	outboxProducer, err := kafka.NewProducer(producerConfig)
+	if err != nil {
+		slog.Error("Invalid Kafka producer configuration", "error", err)
+		os.Exit(1)
+	}
+	defer outboxProducer.Close()
+	outboxRelay := outbox.NewRelay(outbox.NewPostgresStore(db), outboxProducer, outbox.RelayConfig{
+		Name:         "auth",
+		PollInterval: viper.GetDuration("outbox.poll_interval_ms") * time.Millisecond,
+		BatchSize:    viper.GetInt("outbox.batch_size"),
+		Lease:        viper.GetDuration("outbox.lease_seconds") * time.Second,
+		MinBackoff:   viper.GetDuration("outbox.min_backoff_ms") * time.Millisecond,
+		MaxBackoff:   viper.GetDuration("outbox.max_backoff_seconds") * time.Second,
+	})
+	go outboxRelay.Run(ctx)
+
+	// --- Kafka Consumer Initialization ---
+	// Players rename themselves in the player-profile service; its events keep the usernames they
+	// sign in with up to date. Events that keep failing are moved to the dead-letter topic.
+	deadLetters, err := kafka.NewDeadLetterProducer(producerConfig)
+	if err != nil {
+		slog.Error("Invalid Kafka producer configuration", "error", err)
+		os.Exit(1)
+	}
+	defer deadLetters.Close()
+	profileReader := kafka.NewConsumer(
+		viper.GetStringSlice("kafka.brokers"),
+		viper.GetString("kafka.profile_updated_topic"),
+		viper.GetString("kafka.consumer_group_id"),
+	)
+	profileConsumer := auth.NewProfileConsumer(codec, repo)
+	profileRunner := kafka.NewRunner(profileReader, deadLetters, profileConsumer.HandleMessage, kafka.RunnerConfig{
+		Name:         "auth.profile_updated",
+		MaxAttempts:  viper.GetInt("kafka.consumer.max_attempts"),
+		MinBackoff:   viper.GetDuration("kafka.consumer.min_backoff_ms") * time.Millisecond,
+		MaxBackoff:   viper.GetDuration("kafka.consumer.max_backoff_seconds") * time.Second,
+		Concurrency:  viper.GetInt("kafka.consumer.concurrency_per_partition"),
+		DrainTimeout: viper.GetDuration("kafka.consumer.drain_timeout_seconds") * time.Second,
+	})
+	profileDone := make(chan struct{})
+	go func() {
+		defer close(profileDone)
+		profileRunner.Run(ctx)
+	}()
+
+	svc := auth.NewService(repo, sessionStore, keyManager, loginLimiter, mailer, passwordHasher, svcConfig)
+	// The client IP of a login, which the per-IP limit is keyed on, is only taken from the
+	// "x-forwarded-for" metadata of trusted callers such as the API gateway.
+	trustedProxies, err := auth.ParseTrustedProxies(viper.GetStringSlice("grpc_server.trusted_proxies"))
+	if err != nil {
+		slog.Error("Invalid trusted proxies", "error", err)
+		os.Exit(1)
+	}
+	grpcHandler := auth.NewGRPCHandler(svc, trustedProxies)
 
 	// --- gRPC Server Initialization ---
 	grpcPort := viper.GetString("grpc_server.port")
@@ -113,6 +311,8 @@ func main() {
 	<-quit
 
 	slog.Info("Shutting down gRPC server...")
+	cancel() // Stop the key rotation, account purge and outbox relay loops and the profile consumer.
 	grpcServer.GracefulStop()
+	<-profileDone // Events being handled are finished and committed before exiting.
 	slog.Info("gRPC server shut down gracefully.")
 }
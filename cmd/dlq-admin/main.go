@@ -0,0 +1,249 @@
+// Command dlq-admin inspects the dead-letter topics of the Kafka consumers and replays their
+// messages to the topics they came from.
+//
+//	dlq-admin list   -topic match_found_events.dlq [-values]
+//	dlq-admin replay -topic match_found_events.dlq -partition 0 -offset 42
+//	dlq-admin replay -topic match_found_events.dlq -all
+//
+// Kafka cannot delete single messages, so replayed messages stay in the dead-letter topic. Replaying
+// with -all records its progress in a consumer group, so running it again only replays messages
+// dead-lettered since.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	kafkautil "github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
+)
+
+// replayGroupPrefix names the consumer group that tracks the progress of "replay -all" per topic.
+const replayGroupPrefix = "dlq-admin-replay."
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage:
+  dlq-admin list   -topic <topic>.dlq [-brokers host:port,...] [-values]
+  dlq-admin replay -topic <topic>.dlq [-brokers host:port,...] (-partition <p> -offset <o> | -all)`)
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	brokers := flags.String("brokers", "localhost:9092", "Comma-separated Kafka brokers")
+	topic := flags.String("topic", "", "Dead-letter topic, e.g. match_found_events.dlq")
+	values := flags.Bool("values", false, "list: print the message values")
+	partition := flags.Int("partition", -1, "replay: partition of the message to replay")
+	offset := flags.Int64("offset", -1, "replay: offset of the message to replay")
+	all := flags.Bool("all", false, "replay: replay every message not replayed by an earlier -all")
+	idle := flags.Duration("idle", 5*time.Second, "replay -all: stop once no message arrives for this long")
+	flags.Parse(os.Args[2:])
+
+	if !strings.HasSuffix(*topic, kafkautil.DeadLetterSuffix) {
+		fmt.Fprintf(os.Stderr, "-topic must name a dead-letter topic ending in %q\n", kafkautil.DeadLetterSuffix)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	brokerList := strings.Split(*brokers, ",")
+	var err error
+	switch os.Args[1] {
+	case "list":
+		err = list(ctx, brokerList, *topic, *values)
+	case "replay":
+		if !*all && (*partition < 0 || *offset < 0) {
+			usage()
+		}
+		// Replayed messages are acknowledged by every in-sync replica before they count as replayed.
+		var producer *kafkautil.Producer
+		producer, err = kafkautil.NewProducer(kafkautil.ProducerConfig{Brokers: brokerList, Timeout: 30 * time.Second})
+		if err != nil {
+			break
+		}
+		defer producer.Close()
+		if *all {
+			err = replayAll(ctx, brokerList, producer, *topic, *idle)
+		} else {
+			err = replayOne(ctx, brokerList, producer, *topic, *partition, *offset)
+		}
+	default:
+		usage()
+	}
+
+	if err != nil {
+		slog.Error("dlq-admin failed", "command", os.Args[1], "topic", *topic, "error", err)
+		os.Exit(1)
+	}
+}
+
+// list prints every message currently in the topic, partition by partition.
+func list(ctx context.Context, brokers []string, topic string, values bool) error {
+	count := 0
+	err := scan(ctx, brokers, topic, func(msg kafka.Message) error {
+		count++
+		fmt.Printf("partition=%d offset=%d key=%q\n", msg.Partition, msg.Offset, msg.Key)
+		fmt.Printf("  from:     %s [%s] @%s\n", kafkautil.HeaderValue(msg, kafkautil.HeaderOriginalTopic),
+			kafkautil.HeaderValue(msg, kafkautil.HeaderOriginalPartition), kafkautil.HeaderValue(msg, kafkautil.HeaderOriginalOffset))
+		fmt.Printf("  consumer: %s\n", kafkautil.HeaderValue(msg, kafkautil.HeaderConsumer))
+		fmt.Printf("  failed:   %s after %s attempt(s)\n", kafkautil.HeaderValue(msg, kafkautil.HeaderFailedAt),
+			kafkautil.HeaderValue(msg, kafkautil.HeaderAttempts))
+		fmt.Printf("  error:    %s\n", kafkautil.HeaderValue(msg, kafkautil.HeaderError))
+		if values {
+			fmt.Printf("  value:    %q\n", msg.Value)
+		}
+		return nil
+	})
+	fmt.Printf("%d message(s) in %s\n", count, topic)
+	return err
+}
+
+// replayOne republishes the message at the given position.
+func replayOne(ctx context.Context, brokers []string, producer *kafkautil.Producer, topic string, partition int, offset int64) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{Brokers: brokers, Topic: topic, Partition: partition})
+	defer reader.Close()
+	if err := reader.SetOffset(offset); err != nil {
+		return err
+	}
+
+	readCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	msg, err := reader.ReadMessage(readCtx)
+	if err != nil {
+		return fmt.Errorf("reading partition %d offset %d: %w", partition, offset, err)
+	}
+	if msg.Offset != offset {
+		// The message was removed by retention; the reader skipped ahead to the next one.
+		return fmt.Errorf("partition %d has no message at offset %d", partition, offset)
+	}
+
+	return replay(ctx, producer, msg)
+}
+
+// replayAll republishes the messages the replay consumer group has not seen yet.
+func replayAll(ctx context.Context, brokers []string, producer *kafkautil.Producer, topic string, idle time.Duration) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		Topic:       topic,
+		GroupID:     replayGroupPrefix + topic,
+		StartOffset: kafka.FirstOffset,
+	})
+	defer reader.Close()
+
+	replayed := 0
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, idle)
+		msg, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			break // Nothing left to replay.
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := replay(ctx, producer, msg); err != nil {
+			return err
+		}
+		if err := reader.CommitMessages(ctx, msg); err != nil {
+			return err
+		}
+		replayed++
+	}
+
+	fmt.Printf("Replayed %d message(s) from %s\n", replayed, topic)
+	return nil
+}
+
+// replay publishes a dead-lettered message to its original topic, without the dead-letter headers.
+func replay(ctx context.Context, producer *kafkautil.Producer, msg kafka.Message) error {
+	original := kafkautil.HeaderValue(msg, kafkautil.HeaderOriginalTopic)
+	if original == "" {
+		original = strings.TrimSuffix(msg.Topic, kafkautil.DeadLetterSuffix)
+	}
+
+	headers := make([]kafka.Header, 0, len(msg.Headers))
+	for _, h := range msg.Headers {
+		if !kafkautil.IsDeadLetterHeader(h.Key) {
+			headers = append(headers, h)
+		}
+	}
+
+	err := producer.Publish(ctx, kafka.Message{Topic: original, Key: msg.Key, Value: msg.Value, Headers: headers})
+	if err != nil {
+		return fmt.Errorf("replaying partition %d offset %d to %s: %w", msg.Partition, msg.Offset, original, err)
+	}
+	fmt.Printf("Replayed partition=%d offset=%d to %s\n", msg.Partition, msg.Offset, original)
+	return nil
+}
+
+// scan calls fn for every message in the topic up to the end of each partition at the time of the call.
+func scan(ctx context.Context, brokers []string, topic string, fn func(kafka.Message) error) error {
+	conn, err := kafka.DialContext(ctx, "tcp", brokers[0])
+	if err != nil {
+		return err
+	}
+	partitions, err := conn.ReadPartitions(topic)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].ID < partitions[j].ID })
+
+	for _, p := range partitions {
+		leader, err := kafka.DialLeader(ctx, "tcp", brokers[0], topic, p.ID)
+		if err != nil {
+			return err
+		}
+		first, last, err := leader.ReadOffsets()
+		leader.Close()
+		if err != nil {
+			return err
+		}
+		if first >= last {
+			continue // Empty partition.
+		}
+
+		if err := scanPartition(ctx, brokers, topic, p.ID, first, last, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanPartition calls fn for the messages of a partition from offset first up to, excluding, last.
+func scanPartition(ctx context.Context, brokers []string, topic string, partition int, first, last int64, fn func(kafka.Message) error) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{Brokers: brokers, Topic: topic, Partition: partition})
+	defer reader.Close()
+	if err := reader.SetOffset(first); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return err
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+		if msg.Offset >= last-1 {
+			return nil
+		}
+	}
+}
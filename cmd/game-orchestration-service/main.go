@@ -10,12 +10,16 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
 
 	"github.com/cheildo/nexus-clash-backend/internal/orchestration"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/events"
 	"github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/outbox"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/redis"
 
 	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
 )
@@ -43,13 +47,72 @@ func main() {
 		viper.GetString("kafka.match_found_topic"),
 		viper.GetString("kafka.consumer_group_id"),
 	)
-	producer := kafka.NewProducer(
-		viper.GetStringSlice("kafka.brokers"),
-		viper.GetString("kafka.server_ready_topic"),
-	)
+
+	// --- Redis Connection for the outbox ---
+	rdb, err := redis.NewClient(redis.Config{
+		Addr:     viper.GetString("redis.addr"),
+		Password: viper.GetString("redis.password"),
+		DB:       viper.GetInt("redis.db"),
+	})
+	if err != nil {
+		slog.Error("Failed to connect to Redis", "error", err)
+		os.Exit(1)
+	}
+	defer rdb.Close()
+
+	// Server events are stored in a Redis outbox and relayed to Kafka, retrying until they are delivered.
+	eventOutbox := outbox.NewRedisStore(rdb, viper.GetString("outbox.key_prefix"))
+	// Publishing waits for Kafka to acknowledge each write and retries failures, see kafka.Producer.
+	producerConfig := kafka.ProducerConfig{
+		Brokers:      viper.GetStringSlice("kafka.brokers"),
+		RequiredAcks: viper.GetString("kafka.producer.required_acks"),
+		MaxAttempts:  viper.GetInt("kafka.producer.max_attempts"),
+		MinBackoff:   viper.GetDuration("kafka.producer.min_backoff_ms") * time.Millisecond,
+		MaxBackoff:   viper.GetDuration("kafka.producer.max_backoff_seconds") * time.Second,
+		Timeout:      viper.GetDuration("kafka.producer.timeout_seconds") * time.Second,
+	}
+	outboxProducer, err := kafka.NewProducer(producerConfig)
+	if err != nil {
+		slog.Error("Invalid Kafka producer configuration", "error", err)
+		os.Exit(1)
+	}
+	defer outboxProducer.Close()
+	outboxRelay := outbox.NewRelay(eventOutbox, outboxProducer, outbox.RelayConfig{
+		Name:         "orchestration",
+		PollInterval: viper.GetDuration("outbox.poll_interval_ms") * time.Millisecond,
+		BatchSize:    viper.GetInt("outbox.batch_size"),
+		Lease:        viper.GetDuration("outbox.lease_seconds") * time.Second,
+		MinBackoff:   viper.GetDuration("outbox.min_backoff_ms") * time.Millisecond,
+		MaxBackoff:   viper.GetDuration("outbox.max_backoff_seconds") * time.Second,
+	})
 
 	// --- Dependency Injection ---
-	listener := orchestration.NewListener(consumer, producer)
+	eventFormat, err := events.ParseFormat(viper.GetString("kafka.event_format"))
+	if err != nil {
+		slog.Error("Invalid event format", "error", err)
+		os.Exit(1)
+	}
+	codec := events.NewCodec(eventFormat)
+	// Redelivered match_found events are dropped once their match is provisioned, so it is only provisioned once.
+	processedMatches := events.NewProcessedStore(rdb, viper.GetString("dedupe.key_prefix"), viper.GetDuration("dedupe.ttl_hours")*time.Hour)
+	listener := orchestration.NewListener(eventOutbox, processedMatches, codec, viper.GetString("kafka.server_ready_topic"),
+		viper.GetDuration("orchestration.provision_delay_ms")*time.Millisecond,
+		viper.GetDuration("orchestration.provision_timeout_seconds")*time.Second)
+	// Messages that keep failing are moved to the dead-letter topic instead of being skipped.
+	deadLetters, err := kafka.NewDeadLetterProducer(producerConfig)
+	if err != nil {
+		slog.Error("Invalid Kafka producer configuration", "error", err)
+		os.Exit(1)
+	}
+	defer deadLetters.Close()
+	listenerRunner := kafka.NewRunner(consumer, deadLetters, listener.HandleMessage, kafka.RunnerConfig{
+		Name:         "orchestration.match_found",
+		MaxAttempts:  viper.GetInt("kafka.consumer.max_attempts"),
+		MinBackoff:   viper.GetDuration("kafka.consumer.min_backoff_ms") * time.Millisecond,
+		MaxBackoff:   viper.GetDuration("kafka.consumer.max_backoff_seconds") * time.Second,
+		Concurrency:  viper.GetInt("kafka.consumer.concurrency_per_partition"),
+		DrainTimeout: viper.GetDuration("kafka.consumer.drain_timeout_seconds") * time.Second,
+	})
 	grpcHandler := orchestration.NewGRPCHandler(listener)
 
 	app := &application{
@@ -61,7 +124,12 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	go app.startGRPCServer(ctx, grpcHandler, viper.GetString("grpc_server.port"))
-	go app.listener.Run(ctx)
+	listenerDone := make(chan struct{})
+	go func() {
+		defer close(listenerDone)
+		listenerRunner.Run(ctx)
+	}()
+	go outboxRelay.Run(ctx)
 
 	startDiagnosticsServer(viper.GetString("diagnostics.port"))
 
@@ -73,6 +141,7 @@ func main() {
 	slog.Info("Shutting down servers...")
 	cancel() // Signal goroutines to stop
 	app.grpcServer.GracefulStop()
+	<-listenerDone // Matches being provisioned are finished and committed before exiting.
 	slog.Info("Servers shut down gracefully.")
 }
 
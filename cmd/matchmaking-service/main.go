@@ -17,7 +17,9 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/cheildo/nexus-clash-backend/internal/matchmaking"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/events"
 	"github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/outbox"
 	"github.com/cheildo/nexus-clash-backend/internal/pkg/redis"
 )
 
@@ -57,27 +59,62 @@ func main() {
 	}
 	slog.Info("Redis connection successful.")
 
-	// --- Kafka Producer Initialization ---
-	producer := kafka.NewProducer(
-		viper.GetStringSlice("kafka.brokers"),
-		viper.GetString("kafka.match_found_topic"),
-	)
-	defer producer.Close()
-
-	// --- Dependency Injection ---
-	pool := matchmaking.NewPool(rdb, viper.GetString("matchmaking.pool_key"))
-	svc := matchmaking.NewService(
-		pool,
-		producer, // Inject the producer
-		viper.GetDuration("matchmaking.check_interval_seconds")*time.Second,
-		viper.GetInt("matchmaking.players_per_match"),
-	)
-
-	// --- Start Matchmaking Loop ---
 	// We create a cancellable context for graceful shutdown.
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	svc.Start(ctx)
+
+	// --- Outbox Relay Initialization ---
+	// Match events are stored in a Redis outbox in the same transaction that takes the players
+	// from the pool, and the relay publishes them to Kafka, retrying until they are delivered.
+	eventOutbox := outbox.NewRedisStore(rdb, viper.GetString("outbox.key_prefix"))
+	// Publishing waits for Kafka to acknowledge each write and retries failures, see kafka.Producer.
+	producerConfig := kafka.ProducerConfig{
+		Brokers:      viper.GetStringSlice("kafka.brokers"),
+		RequiredAcks: viper.GetString("kafka.producer.required_acks"),
+		MaxAttempts:  viper.GetInt("kafka.producer.max_attempts"),
+		MinBackoff:   viper.GetDuration("kafka.producer.min_backoff_ms") * time.Millisecond,
+		MaxBackoff:   viper.GetDuration("kafka.producer.max_backoff_seconds") * time.Second,
+		Timeout:      viper.GetDuration("kafka.producer.timeout_seconds") * time.Second,
+	}
+	outboxProducer, err := kafka.NewProducer(producerConfig)
+	if err != nil {
+		slog.Error("Invalid Kafka producer configuration", "error", err)
+		os.Exit(1)
+	}
+	defer outboxProducer.Close()
+	outboxRelay := outbox.NewRelay(eventOutbox, outboxProducer, outbox.RelayConfig{
+		Name:         "matchmaking",
+		PollInterval: viper.GetDuration("outbox.poll_interval_ms") * time.Millisecond,
+		BatchSize:    viper.GetInt("outbox.batch_size"),
+		Lease:        viper.GetDuration("outbox.lease_seconds") * time.Second,
+		MinBackoff:   viper.GetDuration("outbox.min_backoff_ms") * time.Millisecond,
+		MaxBackoff:   viper.GetDuration("outbox.max_backoff_seconds") * time.Second,
+	})
+	go outboxRelay.Run(ctx)
+
+	// --- Start Matchmaking Loops ---
+	eventFormat, err := events.ParseFormat(viper.GetString("kafka.event_format"))
+	if err != nil {
+		slog.Error("Invalid event format", "error", err)
+		os.Exit(1)
+	}
+	codec := events.NewCodec(eventFormat)
+
+	// Each queue mode has its own pool, so casual and ranked players are never matched together.
+	for _, poolKey := range []string{
+		viper.GetString("matchmaking.pool_key"),
+		viper.GetString("matchmaking.ranked_pool_key"),
+	} {
+		pool := matchmaking.NewPool(rdb, poolKey, eventOutbox)
+		svc := matchmaking.NewService(
+			pool,
+			codec,
+			viper.GetString("kafka.match_found_topic"),
+			viper.GetDuration("matchmaking.check_interval_seconds")*time.Second,
+			viper.GetInt("matchmaking.players_per_match"),
+		)
+		svc.Start(ctx)
+	}
 
 	// --- gRPC Server Initialization (for future inter-service communication) ---
 	grpcPort := viper.GetString("grpc_server.port")
@@ -108,7 +145,7 @@ func main() {
 	<-quit
 
 	slog.Info("Shutting down servers...")
-	cancel() // Signal the matchmaking loop to stop.
+	cancel() // Signal the matchmaking loops and the outbox relay to stop.
 	grpcServer.GracefulStop()
 	slog.Info("Servers shut down gracefully.")
 }
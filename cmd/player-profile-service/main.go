@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
@@ -17,6 +20,9 @@ import (
 
 	// Internal packages
 	"github.com/cheildo/nexus-clash-backend/internal/pkg/database"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/events"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/outbox"
 	"github.com/cheildo/nexus-clash-backend/internal/playerprofile"
 
 	// Proto-generated code
@@ -64,10 +70,85 @@ func main() {
 	slog.Info("Database connection successful.")
 
 	// --- Dependency Injection ---
-	repo := playerprofile.NewRepository(db)
+	eventFormat, err := events.ParseFormat(viper.GetString("kafka.event_format"))
+	if err != nil {
+		slog.Error("Invalid event format", "error", err)
+		os.Exit(1)
+	}
+	codec := events.NewCodec(eventFormat)
+	repo := playerprofile.NewRepository(db, playerprofile.EventTopics{
+		ProfileUpdated: viper.GetString("kafka.profile_updated_topic"),
+	}, codec)
 	svc := playerprofile.NewService(repo)
 	grpcHandler := playerprofile.NewGRPCHandler(svc)
 
+	// --- Kafka Consumer Initialization ---
+	// Profiles are created for new users from the registration events of the auth service.
+	registrationReader := kafka.NewConsumer(
+		viper.GetStringSlice("kafka.brokers"),
+		viper.GetString("kafka.user_registered_topic"),
+		viper.GetString("kafka.consumer_group_id"),
+	)
+	// Decoding accepts both wire formats, whatever the format of published events.
+	registrationConsumer := playerprofile.NewRegistrationConsumer(codec, svc)
+	// Malformed events are moved to the dead-letter topic instead of being skipped.
+	// Publishing waits for Kafka to acknowledge each write and retries failures, see kafka.Producer.
+	producerConfig := kafka.ProducerConfig{
+		Brokers:      viper.GetStringSlice("kafka.brokers"),
+		RequiredAcks: viper.GetString("kafka.producer.required_acks"),
+		MaxAttempts:  viper.GetInt("kafka.producer.max_attempts"),
+		MinBackoff:   viper.GetDuration("kafka.producer.min_backoff_ms") * time.Millisecond,
+		MaxBackoff:   viper.GetDuration("kafka.producer.max_backoff_seconds") * time.Second,
+		Timeout:      viper.GetDuration("kafka.producer.timeout_seconds") * time.Second,
+	}
+	deadLetters, err := kafka.NewDeadLetterProducer(producerConfig)
+	if err != nil {
+		slog.Error("Invalid Kafka producer configuration", "error", err)
+		os.Exit(1)
+	}
+	defer deadLetters.Close()
+	registrationRunner := kafka.NewRunner(registrationReader, deadLetters, registrationConsumer.HandleMessage, consumerConfig("player-profile.user_registered"))
+
+	// Profiles of deleted accounts are anonymized, since the auth service only anonymizes its own data.
+	deletionReader := kafka.NewConsumer(
+		viper.GetStringSlice("kafka.brokers"),
+		viper.GetString("kafka.account_deleted_topic"),
+		viper.GetString("kafka.deletion_consumer_group_id"),
+	)
+	deletionConsumer := playerprofile.NewDeletionConsumer(codec, svc)
+	deletionRunner := kafka.NewRunner(deletionReader, deadLetters, deletionConsumer.HandleMessage, consumerConfig("player-profile.account_deleted"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Shutdown waits for the consumers to drain, see below.
+	var consumers sync.WaitGroup
+	for _, runner := range []*kafka.Runner{registrationRunner, deletionRunner} {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			runner.Run(ctx)
+		}()
+	}
+
+	// --- Outbox Relay Initialization ---
+	// Renames are written to the outbox together with the profile, so that the auth service lets
+	// players sign in with their new username. The relay publishes them to Kafka.
+	outboxProducer, err := kafka.NewProducer(producerConfig)
+	if err != nil {
+		slog.Error("Invalid Kafka producer configuration", "error", err)
+		os.Exit(1)
+	}
+	defer outboxProducer.Close()
+	outboxRelay := outbox.NewRelay(outbox.NewPostgresStore(db), outboxProducer, outbox.RelayConfig{
+		Name:         "player-profile",
+		PollInterval: viper.GetDuration("outbox.poll_interval_ms") * time.Millisecond,
+		BatchSize:    viper.GetInt("outbox.batch_size"),
+		Lease:        viper.GetDuration("outbox.lease_seconds") * time.Second,
+		MinBackoff:   viper.GetDuration("outbox.min_backoff_ms") * time.Millisecond,
+		MaxBackoff:   viper.GetDuration("outbox.max_backoff_seconds") * time.Second,
+	})
+	go outboxRelay.Run(ctx)
+
 	// --- gRPC Server Initialization ---
 	grpcPort := viper.GetString("grpc_server.port")
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", grpcPort))
@@ -99,6 +180,20 @@ func main() {
 	<-quit
 
 	slog.Info("Shutting down gRPC server...")
+	cancel() // Stop the consumers and the outbox relay.
 	grpcServer.GracefulStop()
+	consumers.Wait() // Events being handled are finished and committed before exiting.
 	slog.Info("PlayerProfile gRPC server shut down gracefully.")
 }
+
+// consumerConfig returns the retry settings of a Kafka consumer.
+func consumerConfig(name string) kafka.RunnerConfig {
+	return kafka.RunnerConfig{
+		Name:         name,
+		MaxAttempts:  viper.GetInt("kafka.consumer.max_attempts"),
+		MinBackoff:   viper.GetDuration("kafka.consumer.min_backoff_ms") * time.Millisecond,
+		MaxBackoff:   viper.GetDuration("kafka.consumer.max_backoff_seconds") * time.Second,
+		Concurrency:  viper.GetInt("kafka.consumer.concurrency_per_partition"),
+		DrainTimeout: viper.GetDuration("kafka.consumer.drain_timeout_seconds") * time.Second,
+	}
+}
@@ -0,0 +1,97 @@
+package apigateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
+	"github.com/cheildo/nexus-clash-backend/internal/auth"
+)
+
+// UserDataArchive is the downloadable archive of everything stored about a player.
+// Matches are not recorded by any service yet, so there is no match history to include.
+type UserDataArchive struct {
+	ExportedAt time.Time                            `json:"exported_at"`
+	Account    *nexusclashv1.ExportUserDataResponse `json:"account"`
+	// Profile holds the username, level and stats. Unset if the player has no profile.
+	Profile *nexusclashv1.Profile `json:"profile,omitempty"`
+}
+
+// ExportHandler gathers a player's data from the backend services into a single archive.
+type ExportHandler struct {
+	authClient    nexusclashv1.AuthServiceClient
+	profileClient nexusclashv1.PlayerProfileServiceClient
+}
+
+func NewExportHandler(authClient nexusclashv1.AuthServiceClient, profileClient nexusclashv1.PlayerProfileServiceClient) *ExportHandler {
+	return &ExportHandler{
+		authClient:    authClient,
+		profileClient: profileClient,
+	}
+}
+
+// HandleExport is the HTTP handler for the GET /account/export endpoint. It must run behind
+// the Authenticate middleware, and responds with the caller's archive as a JSON attachment.
+func (h *ExportHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "Invalid or expired token")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// The auth service authenticates the caller itself, so the Authorization header is forwarded.
+	account, err := h.authClient.ExportUserData(
+		metadata.AppendToOutgoingContext(ctx, "authorization", r.Header.Get("Authorization")),
+		&nexusclashv1.ExportUserDataRequest{},
+	)
+	if err != nil {
+		if status.Code(err) == codes.Unauthenticated {
+			writeJSONError(w, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+		slog.Error("Failed to export account data", "userID", userID, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to export data")
+		return
+	}
+
+	archive := &UserDataArchive{ExportedAt: time.Now().UTC(), Account: account}
+
+	profile, err := h.profileClient.GetProfile(ctx, &nexusclashv1.GetProfileRequest{
+		UserId: &nexusclashv1.UUID{Value: userID},
+	})
+	switch {
+	case err == nil:
+		archive.Profile = profile.GetProfile()
+	case status.Code(err) == codes.NotFound:
+	default:
+		slog.Error("Failed to export profile", "userID", userID, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to export data")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="nexus-clash-data-%s.json"`, userID))
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(archive); err != nil {
+		slog.Error("Failed to write data export", "userID", userID, "error", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,68 @@
+package apigateway
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/events"
+	kafkautil "github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
+)
+
+// SanctionConsumer drops the WebSocket of players the auth service bans or suspends.
+type SanctionConsumer struct {
+	codec      *events.Codec
+	authClient nexusclashv1.AuthServiceClient
+	cm         *ConnectionManager
+}
+
+func NewSanctionConsumer(codec *events.Codec, authClient nexusclashv1.AuthServiceClient, cm *ConnectionManager) *SanctionConsumer {
+	return &SanctionConsumer{
+		codec:      codec,
+		authClient: authClient,
+		cm:         cm,
+	}
+}
+
+// HandleMessage handles an account sanction event. It is run by a kafka.Runner. Events that
+// arrive late, e.g. after a retry, may describe a suspension that has since expired or a sanction
+// that was lifted; the player is only disconnected if the auth service still sanctions them.
+func (sc *SanctionConsumer) HandleMessage(ctx context.Context, msg kafka.Message) error {
+	event := &nexusclashv1.AccountSanctionedEvent{}
+	if _, err := sc.codec.Decode(msg.Value, event); err != nil {
+		return kafkautil.Permanent(err)
+	}
+
+	userID := event.GetUserId().GetValue()
+	if expiresAt := event.GetExpiresAt(); expiresAt != nil && expiresAt.AsTime().Before(time.Now()) {
+		return nil // The suspension is over.
+	}
+	conn, ok := sc.cm.Get(userID)
+	if !ok {
+		return nil // The player is not connected to this gateway instance.
+	}
+
+	resp, err := sc.authClient.GetActiveSanction(ctx, &nexusclashv1.GetActiveSanctionRequest{UserId: &nexusclashv1.UUID{Value: userID}})
+	if err != nil {
+		return err
+	}
+	if resp.GetSanction() == nil {
+		slog.Info("Skipping lifted sanction", "playerID", userID, "type", event.GetType())
+		return nil
+	}
+
+	// The close frame tells the client why it was disconnected. Closing the connection ends its
+	// read loop, which removes the player from the matchmaking pool.
+	closeMessage := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "account "+event.GetType())
+	if err := conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second)); err != nil {
+		slog.Warn("Failed to send close frame to sanctioned player", "playerID", userID, "error", err)
+	}
+	conn.Close()
+	slog.Info("Disconnected sanctioned player", "playerID", userID, "type", event.GetType())
+	return nil
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// UserDataExport is everything the auth service stores about a player, for data access requests.
+// Secrets such as password hashes and TOTP secrets are left out.
+type UserDataExport struct {
+	User             *User
+	Roles            []string
+	Identities       []*Identity
+	TwoFactorEnabled bool
+	Sanctions        []*Sanction
+}
+
+// DeleteAccount deletes the caller's account. Players with a password must confirm it; players
+// who only sign in through an identity provider or as a guest are identified by their session.
+// The account is anonymized and signed out immediately, and removed for good once the grace
+// period has passed. It returns the time after which the account will be purged.
+func (s *service) DeleteAccount(ctx context.Context, sessionToken, password string) (time.Time, error) {
+	claims, err := s.authenticate(ctx, sessionToken)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if user.PasswordHash != "" {
+		match, err := s.hasher.Verify(password, user.PasswordHash)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !match {
+			return time.Time{}, ErrIncorrectPassword
+		}
+	}
+
+	deletedAt, err := s.repo.SoftDeleteUser(ctx, user.ID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// The refresh tokens were revoked with the deletion; this also ends the live sessions.
+	if err := s.sessions.RevokeAllSessions(ctx, user.ID); err != nil {
+		return time.Time{}, err
+	}
+
+	slog.Info("Account deleted", "userID", user.ID)
+	return deletedAt.Add(s.config.AccountDeletionGracePeriod), nil
+}
+
+// ExportUserData returns the data the auth service holds about the caller.
+func (s *service) ExportUserData(ctx context.Context, sessionToken string) (*UserDataExport, error) {
+	claims, err := s.authenticate(ctx, sessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.repo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := s.repo.ListIdentities(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactorEnabled, err := s.secondFactorRequired(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	sanctions, err := s.repo.ListSanctions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("User data exported", "userID", user.ID)
+	return &UserDataExport{
+		User:             user,
+		Roles:            roles,
+		Identities:       identities,
+		TwoFactorEnabled: twoFactorEnabled,
+		Sanctions:        sanctions,
+	}, nil
+}
+
+// AccountPurger hard-deletes accounts whose deletion grace period has passed.
+type AccountPurger struct {
+	repo        Repository
+	gracePeriod time.Duration
+	interval    time.Duration
+}
+
+func NewAccountPurger(repo Repository, gracePeriod, interval time.Duration) *AccountPurger {
+	return &AccountPurger{repo: repo, gracePeriod: gracePeriod, interval: interval}
+}
+
+// Start purges expired accounts in the background until the context is cancelled.
+func (p *AccountPurger) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			p.purge(ctx)
+			select {
+			case <-ctx.Done():
+				slog.Info("Account purge loop stopping.")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (p *AccountPurger) purge(ctx context.Context) {
+	purged, err := p.repo.PurgeDeletedUsers(ctx, time.Now().Add(-p.gracePeriod))
+	if err != nil {
+		slog.Error("Failed to purge deleted accounts", "error", err)
+		return
+	}
+	if purged > 0 {
+		slog.Info("Purged deleted accounts", "count", purged)
+	}
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Audiences of action tokens. An action token is a signed, single-use JWT that authorizes
+// exactly one action, e.g. verifying an email address. The purpose is carried in the "aud"
+// claim, so a token issued for one action can neither be used for another nor as a session token.
+const (
+	purposeVerifyEmail   = "nexus-clash:verify-email"
+	purposeResetPassword = "nexus-clash:reset-password"
+	purposeSecondFactor  = "nexus-clash:second-factor"
+)
+
+// ErrInvalidActionToken is returned for action tokens that are forged, expired, already used
+// or issued for a different purpose.
+var ErrInvalidActionToken = errors.New("invalid, expired or already used token")
+
+// actionClaims is the payload of an action token.
+type actionClaims struct {
+	UserID string `json:"uid"`
+	// Email binds the token to the address it was sent to, so it stops working if the email changes.
+	Email string `json:"email,omitempty"`
+	// PasswordStamp binds the token to the password it was issued for, so every outstanding
+	// reset token stops working once the password changes.
+	PasswordStamp string `json:"pws,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// issueActionToken creates a signed action token for the given user and purpose.
+func (s *service) issueActionToken(user *User, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := &actionClaims{
+		UserID:        user.ID,
+		Email:         user.Email,
+		PasswordStamp: passwordStamp(user.PasswordHash),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{purpose},
+			ID:        uuid.New().String(),
+		},
+	}
+	return s.signToken(claims)
+}
+
+// passwordStamp derives a short, non-reversible fingerprint of a password hash.
+func passwordStamp(passwordHash string) string {
+	if passwordHash == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:8])
+}
+
+// parseActionToken verifies an action token for the given purpose without using it up.
+func (s *service) parseActionToken(tokenString, purpose string) (*actionClaims, error) {
+	claims := &actionClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, s.keys.Keyfunc,
+		jwt.WithValidMethods(s.keys.ValidMethods()), jwt.WithExpirationRequired(), jwt.WithAudience(purpose))
+	if err != nil || claims.UserID == "" || claims.ID == "" {
+		return nil, ErrInvalidActionToken
+	}
+	return claims, nil
+}
+
+// consumeActionToken verifies an action token for the given purpose and marks it as used.
+// A second call with the same token fails with ErrInvalidActionToken.
+func (s *service) consumeActionToken(ctx context.Context, tokenString, purpose string) (*actionClaims, error) {
+	claims, err := s.parseActionToken(tokenString, purpose)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.markActionTokenUsed(ctx, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// markActionTokenUsed records the token ID as used, failing if it was used before.
+func (s *service) markActionTokenUsed(ctx context.Context, claims *actionClaims) error {
+	firstUse, err := s.sessions.ConsumeTokenID(ctx, claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return err
+	}
+	if !firstUse {
+		return ErrInvalidActionToken
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies holds the networks of the proxies whose X-Forwarded-For headers are honoured.
+// The per-IP login limit is keyed on the client IP, so it may only be taken from a forwarding
+// header that a trusted proxy set; anyone else could pick a new address for every attempt.
+type TrustedProxies struct {
+	networks []*net.IPNet
+}
+
+// ParseTrustedProxies parses a list of CIDR ranges or single IPs, e.g. "10.0.0.0/8" or "127.0.0.1".
+// An empty list trusts no proxy, so the address of the connection is always used.
+func ParseTrustedProxies(entries []string) (*TrustedProxies, error) {
+	t := &TrustedProxies{}
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			t.networks = append(t.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		t.networks = append(t.networks, network)
+	}
+	return t, nil
+}
+
+func (t *TrustedProxies) trusts(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range t.networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP of the client behind a connection from peerAddr, given the values of
+// its X-Forwarded-For headers. The header is only read while the hop that sent it is trusted:
+// addresses are taken from the right, past the trusted proxies, and the first untrusted one is
+// the client. Entries left of it may be made up by the client and are ignored.
+func (t *TrustedProxies) ClientIP(peerAddr string, forwardedFor []string) string {
+	ip := hostOf(peerAddr)
+
+	var hops []string
+	for _, value := range forwardedFor {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hostOf(hop))
+			}
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0 && t.trusts(ip); i-- {
+		if net.ParseIP(hops[i]) == nil {
+			break // A malformed entry cannot be attributed, so the last trusted hop is used.
+		}
+		ip = hops[i]
+	}
+	return ip
+}
+
+// RealIP is an HTTP middleware that replaces RemoteAddr with the client IP, see ClientIP.
+// Unlike chi's middleware.RealIP, it ignores forwarding headers sent by untrusted peers.
+func (t *TrustedProxies) RealIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RemoteAddr = t.ClientIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For"))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hostOf strips the port from an address, if it has one.
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Intents of a federated login flow. The flow token records the intent, so a flow started
+// for signing in cannot be completed as a link and vice versa.
+const (
+	federatedIntentLogin = "login"
+	federatedIntentLink  = "link"
+)
+
+// purposeOIDCFlow is the audience of flow tokens, see action_tokens.go.
+const purposeOIDCFlow = "nexus-clash:oidc-flow"
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	// ErrInvalidFederatedLogin is returned when the flow state does not match, has expired,
+	// or the provider rejects the authorization code or returns an invalid ID token.
+	ErrInvalidFederatedLogin = errors.New("sign-in with the identity provider failed or has expired")
+	// ErrIdentityNotLinked is returned when a provider account is unknown but its email belongs to
+	// an existing player. Linking by email alone would let anyone who controls an account at the
+	// provider with that address take over the player, so the player has to link it explicitly.
+	ErrIdentityNotLinked = errors.New("an account with this email already exists; sign in and link the provider from your account")
+)
+
+// oidcFlowClaims carry the state of an authorization code flow between its start and the callback.
+// The gateway keeps the signed token in a short-lived cookie, so the auth service stays stateless.
+type oidcFlowClaims struct {
+	Provider     string `json:"prv"`
+	Intent       string `json:"int"`
+	State        string `json:"st"`
+	CodeVerifier string `json:"cv"`
+	Nonce        string `json:"nonce"`
+	// UserID is the signed-in player an identity is linked to. Only set for link flows.
+	UserID string `json:"uid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// FederatedLoginStart is what a client needs to send the player to the identity provider.
+type FederatedLoginStart struct {
+	AuthorizationURL string
+	// FlowToken must be presented again with the authorization code when the provider redirects back.
+	FlowToken string
+}
+
+// StartFederatedLogin begins an authorization code flow with PKCE at the given provider.
+// For link flows the caller must be signed in, and the identity is linked to their account.
+func (s *service) StartFederatedLogin(ctx context.Context, providerName string, link bool, sessionToken string) (*FederatedLoginStart, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	flow := &oidcFlowClaims{Provider: providerName, Intent: federatedIntentLogin}
+	redirectURL := provider.config.RedirectURL
+	if link {
+		claims, err := s.authenticate(ctx, sessionToken)
+		if err != nil {
+			return nil, err
+		}
+		if provider.config.LinkRedirectURL == "" {
+			return nil, fmt.Errorf("%w: linking is not configured", ErrUnknownProvider)
+		}
+		flow.Intent = federatedIntentLink
+		flow.UserID = claims.UserID
+		redirectURL = provider.config.LinkRedirectURL
+	}
+
+	var err error
+	if flow.State, err = randomURLToken(16); err != nil {
+		return nil, err
+	}
+	if flow.Nonce, err = randomURLToken(16); err != nil {
+		return nil, err
+	}
+	// RFC 7636 requires 43 to 128 characters; 32 bytes encode to 43.
+	if flow.CodeVerifier, err = randomURLToken(32); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	flow.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(s.config.FederatedFlowDuration)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		Audience:  jwt.ClaimStrings{purposeOIDCFlow},
+		ID:        uuid.New().String(),
+	}
+	flowToken, err := s.signToken(flow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FederatedLoginStart{
+		AuthorizationURL: provider.authCodeURL(redirectURL, flow.State, flow.Nonce, flow.CodeVerifier),
+		FlowToken:        flowToken,
+	}, nil
+}
+
+// CompleteFederatedLogin finishes a login flow. Players are found by their linked identity; unknown
+// identities get a new account, unless their email already belongs to a player (see ErrIdentityNotLinked).
+func (s *service) CompleteFederatedLogin(ctx context.Context, providerName, code, state, flowToken string) (*LoginResult, error) {
+	_, idClaims, err := s.completeFlow(ctx, providerName, federatedIntentLogin, code, state, flowToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByIdentity(ctx, providerName, idClaims.Subject)
+	if errors.Is(err, ErrIdentityNotFound) {
+		user, err = s.registerFederatedUser(ctx, providerName, idClaims)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Two-factor authentication protects the account however the player signs in.
+	required, err := s.secondFactorRequired(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if required {
+		challenge, err := s.issueActionToken(user, purposeSecondFactor, s.config.SecondFactorChallengeDuration)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{ChallengeToken: challenge}, nil
+	}
+
+	session, err := s.issueSession(ctx, user, uuid.New().String(), "")
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Federated login succeeded", "userID", user.ID, "provider", providerName)
+	return &LoginResult{Session: session}, nil
+}
+
+// LinkIdentity finishes a link flow by attaching the provider account to the signed-in caller.
+func (s *service) LinkIdentity(ctx context.Context, sessionToken, providerName, code, state, flowToken string) error {
+	claims, err := s.authenticate(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	flow, idClaims, err := s.completeFlow(ctx, providerName, federatedIntentLink, code, state, flowToken)
+	if err != nil {
+		return err
+	}
+	// The flow must have been started by the same player who completes it.
+	if flow.UserID != claims.UserID {
+		return ErrInvalidFederatedLogin
+	}
+
+	err = s.repo.CreateIdentity(ctx, &Identity{
+		UserID:   claims.UserID,
+		Provider: providerName,
+		Subject:  idClaims.Subject,
+		Email:    normalizeEmail(idClaims.Email),
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Identity linked", "userID", claims.UserID, "provider", providerName)
+	return nil
+}
+
+// completeFlow checks the flow token against the callback and exchanges the authorization code.
+func (s *service) completeFlow(ctx context.Context, providerName, intent, code, state, flowToken string) (*oidcFlowClaims, *idTokenClaims, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, nil, ErrUnknownProvider
+	}
+
+	flow := &oidcFlowClaims{}
+	_, err := jwt.ParseWithClaims(flowToken, flow, s.keys.Keyfunc,
+		jwt.WithValidMethods(s.keys.ValidMethods()), jwt.WithExpirationRequired(), jwt.WithAudience(purposeOIDCFlow))
+	if err != nil || flow.ID == "" || flow.Provider != providerName || flow.Intent != intent {
+		return nil, nil, ErrInvalidFederatedLogin
+	}
+	// The state returned by the provider must be the one this client was sent off with (CSRF protection).
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(flow.State)) != 1 {
+		return nil, nil, ErrInvalidFederatedLogin
+	}
+
+	firstUse, err := s.sessions.ConsumeTokenID(ctx, flow.ID, flow.ExpiresAt.Time)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !firstUse {
+		return nil, nil, ErrInvalidFederatedLogin
+	}
+
+	redirectURL := provider.config.RedirectURL
+	if intent == federatedIntentLink {
+		redirectURL = provider.config.LinkRedirectURL
+	}
+
+	idClaims, err := provider.exchange(ctx, code, flow.CodeVerifier, redirectURL, flow.Nonce)
+	if err != nil {
+		slog.Warn("Federated login rejected", "provider", providerName, "error", err)
+		return nil, nil, ErrInvalidFederatedLogin
+	}
+
+	return flow, idClaims, nil
+}
+
+// registerFederatedUser creates a password-less player for a new provider account.
+func (s *service) registerFederatedUser(ctx context.Context, providerName string, idClaims *idTokenClaims) (*User, error) {
+	email := normalizeEmail(idClaims.Email)
+	if email == "" {
+		return nil, fmt.Errorf("%w: the provider did not share an email address", ErrInvalidFederatedLogin)
+	}
+
+	if _, err := s.repo.GetUserByEmail(ctx, email); err == nil {
+		return nil, ErrIdentityNotLinked
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+
+	identity := &Identity{Provider: providerName, Subject: idClaims.Subject, Email: email}
+	base := usernameBase(idClaims)
+
+	// The username is derived from the provider profile plus a random suffix, and retried on the
+	// rare collision. Players can change it later.
+	const maxAttempts = 3
+	for attempt := 1; ; attempt++ {
+		suffix, err := randomHex(2)
+		if err != nil {
+			return nil, err
+		}
+		user := &User{
+			Email:         email,
+			Username:      base + "_" + suffix,
+			EmailVerified: idClaims.EmailVerified,
+		}
+
+		user.ID, err = s.repo.CreateFederatedUser(ctx, user, identity)
+		if err == nil {
+			slog.Info("New user registered through identity provider", "userID", user.ID, "provider", providerName)
+			return user, nil
+		}
+		if !errors.Is(err, ErrEmailOrUserExists) || attempt == maxAttempts {
+			return nil, err
+		}
+	}
+}
+
+// usernameBase derives a username from the provider profile, keeping only letters, digits and underscores.
+func usernameBase(idClaims *idTokenClaims) string {
+	candidate := idClaims.PreferredUsername
+	if candidate == "" {
+		candidate = idClaims.Name
+	}
+	if candidate == "" {
+		candidate, _, _ = strings.Cut(idClaims.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, r := range candidate {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') {
+			b.WriteRune(r)
+		}
+		if b.Len() == 20 {
+			break
+		}
+	}
+	if b.Len() < 3 {
+		return "player"
+	}
+	return b.String()
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
+)
+
+// oidcFlowCookie holds the flow token between the redirect to the provider and the callback.
+const oidcFlowCookie = "nc_oidc_flow"
+
+// oidcFlowCookieMaxAge bounds how long the cookie lives; the flow token carries its own, shorter expiry.
+const oidcFlowCookieMaxAge = 15 * time.Minute
+
+// setFlowCookie stores the flow token in an HttpOnly cookie. SameSite=Lax still sends it on the
+// top-level redirect back from the provider, but not on cross-site subrequests.
+func setFlowCookie(w http.ResponseWriter, flowToken string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    flowToken,
+		Path:     "/api/v1/auth",
+		MaxAge:   int(oidcFlowCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// takeFlowCookie returns the flow token and clears the cookie, since a flow can only complete once.
+func takeFlowCookie(w http.ResponseWriter, r *http.Request) string {
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err != nil {
+		return ""
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    "",
+		Path:     "/api/v1/auth",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return cookie.Value
+}
+
+// writeFederationError translates the gRPC errors of the federated login RPCs to HTTP responses.
+func (h *HTTPHandler) writeFederationError(w http.ResponseWriter, err error, fallback string) {
+	st, _ := status.FromError(err)
+	switch st.Code() {
+	case codes.NotFound:
+		h.writeError(w, http.StatusNotFound, st.Message())
+	case codes.Unauthenticated:
+		h.writeError(w, http.StatusUnauthorized, st.Message())
+	case codes.PermissionDenied:
+		h.writeError(w, http.StatusForbidden, st.Message())
+	case codes.FailedPrecondition, codes.AlreadyExists:
+		h.writeError(w, http.StatusConflict, st.Message())
+	default:
+		h.writeError(w, http.StatusInternalServerError, fallback)
+	}
+}
+
+// HandleFederatedLogin is the HTTP handler for the GET /oidc/{provider}/login endpoint.
+// It redirects the player to the identity provider.
+func (h *HTTPHandler) HandleFederatedLogin(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.authClient.StartFederatedLogin(ctx, &nexusclashv1.StartFederatedLoginRequest{
+		Provider: chi.URLParam(r, "provider"),
+	})
+	if err != nil {
+		h.writeFederationError(w, err, "Failed to start sign-in")
+		return
+	}
+
+	setFlowCookie(w, resp.GetFlowToken())
+	http.Redirect(w, r, resp.GetAuthorizationUrl(), http.StatusFound)
+}
+
+// HandleFederatedCallback is the HTTP handler for the GET /oidc/{provider}/callback endpoint,
+// which the identity provider redirects the player back to.
+func (h *HTTPHandler) HandleFederatedCallback(w http.ResponseWriter, r *http.Request) {
+	flowToken := takeFlowCookie(w, r)
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		// The player declined or the provider failed, e.g. "access_denied".
+		h.writeError(w, http.StatusUnauthorized, "Sign-in was not completed: "+providerErr)
+		return
+	}
+	if flowToken == "" {
+		h.writeError(w, http.StatusBadRequest, "Sign-in session not found or expired")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	resp, err := h.authClient.CompleteFederatedLogin(ctx, &nexusclashv1.CompleteFederatedLoginRequest{
+		Provider:  chi.URLParam(r, "provider"),
+		Code:      query.Get("code"),
+		State:     query.Get("state"),
+		FlowToken: flowToken,
+	})
+	if err != nil {
+		h.writeFederationError(w, err, "Sign-in failed")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleStartLinkIdentity is the HTTP handler for the POST /identities/{provider}/start endpoint.
+// It returns the provider URL for linking instead of redirecting, since it is called by the client with a bearer token.
+func (h *HTTPHandler) HandleStartLinkIdentity(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.authClient.StartFederatedLogin(withAuthorization(ctx, r), &nexusclashv1.StartFederatedLoginRequest{
+		Provider: chi.URLParam(r, "provider"),
+		Link:     true,
+	})
+	if err != nil {
+		h.writeFederationError(w, err, "Failed to start linking")
+		return
+	}
+
+	setFlowCookie(w, resp.GetFlowToken())
+	h.writeJSON(w, http.StatusOK, map[string]string{"authorization_url": resp.GetAuthorizationUrl()})
+}
+
+// HandleLinkIdentity is the HTTP handler for the POST /identities/{provider} endpoint.
+// The body carries the "code" and "state" the provider redirected back to the client with.
+func (h *HTTPHandler) HandleLinkIdentity(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	flowToken := takeFlowCookie(w, r)
+	if flowToken == "" {
+		h.writeError(w, http.StatusBadRequest, "Linking session not found or expired")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	_, err := h.authClient.LinkIdentity(withAuthorization(ctx, r), &nexusclashv1.LinkIdentityRequest{
+		Provider:  chi.URLParam(r, "provider"),
+		Code:      body.Code,
+		State:     body.State,
+		FlowToken: flowToken,
+	})
+	if err != nil {
+		h.writeFederationError(w, err, "Failed to link identity")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
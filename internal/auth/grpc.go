@@ -4,10 +4,16 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"strings"
 
 	//"google.golang.org/grpc"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
 )
@@ -18,10 +24,12 @@ type GRPCHandler struct {
 	// It ensures that if new methods are added to the .proto file, our server won't fail to compile.
 	nexusclashv1.UnimplementedAuthServiceServer
 	svc Service
+	// trustedProxies are the callers, usually the API gateway, whose "x-forwarded-for" metadata names the client.
+	trustedProxies *TrustedProxies
 }
 
-func NewGRPCHandler(svc Service) *GRPCHandler {
-	return &GRPCHandler{svc: svc}
+func NewGRPCHandler(svc Service, trustedProxies *TrustedProxies) *GRPCHandler {
+	return &GRPCHandler{svc: svc, trustedProxies: trustedProxies}
 }
 
 // Register handles the incoming gRPC request for user registration.
@@ -35,6 +43,9 @@ func (h *GRPCHandler) Register(ctx context.Context, req *nexusclashv1.RegisterRe
 		if errors.Is(err, ErrEmailOrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, err.Error())
 		}
+		if errors.Is(err, ErrInvalidUsername) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		// For any other error, return a generic Internal error to avoid leaking implementation details.
 		return nil, status.Error(codes.Internal, "an unexpected error occurred")
 	}
@@ -45,19 +56,608 @@ func (h *GRPCHandler) Register(ctx context.Context, req *nexusclashv1.RegisterRe
 
 // Login handles the incoming gRPC request for user login.
 func (h *GRPCHandler) Login(ctx context.Context, req *nexusclashv1.LoginRequest) (*nexusclashv1.LoginResponse, error) {
-	slog.Info("gRPC Login request received", "email", req.GetEmail())
+	// Older clients still send the email field.
+	identifier := req.GetIdentifier()
+	if identifier == "" {
+		identifier = req.GetEmail()
+	}
+	slog.Info("gRPC Login request received", "identifier", identifier)
 
 	// Call the business logic service to perform the login.
-	token, err := h.svc.Login(ctx, req.GetEmail(), req.GetPassword())
+	result, err := h.svc.Login(ctx, identifier, req.GetPassword(), h.clientIP(ctx))
 	if err != nil {
 		// Map our internal errors to appropriate gRPC status codes.
 		if errors.Is(err, ErrUserNotFound) {
 			return nil, status.Error(codes.NotFound, "invalid credentials")
 		}
+		if errors.Is(err, ErrTooManyLoginAttempts) {
+			return nil, retryAfterStatus(err)
+		}
+		if errors.Is(err, ErrAccountSanctioned) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
 		// Return a generic Internal error for other failures.
 		return nil, status.Error(codes.Internal, "an unexpected error occurred")
 	}
 
-	// On success, return the response containing the session token.
-	return &nexusclashv1.LoginResponse{SessionToken: token}, nil
+	if result.Session == nil {
+		return &nexusclashv1.LoginResponse{
+			SecondFactorRequired: true,
+			ChallengeToken:       result.ChallengeToken,
+		}, nil
+	}
+
+	// On success, return the response containing the session and refresh tokens.
+	return &nexusclashv1.LoginResponse{
+		SessionToken: result.Session.AccessToken,
+		RefreshToken: result.Session.RefreshToken,
+	}, nil
+}
+
+// CreateGuest handles the incoming gRPC request for creating a guest account.
+func (h *GRPCHandler) CreateGuest(ctx context.Context, req *nexusclashv1.CreateGuestRequest) (*nexusclashv1.CreateGuestResponse, error) {
+	guest, err := h.svc.CreateGuest(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	return &nexusclashv1.CreateGuestResponse{
+		UserId:       &nexusclashv1.UUID{Value: guest.UserID},
+		DeviceSecret: guest.DeviceSecret,
+		SessionToken: guest.Session.AccessToken,
+		RefreshToken: guest.Session.RefreshToken,
+	}, nil
+}
+
+// LoginGuest handles the incoming gRPC request for signing a guest in with their device secret.
+func (h *GRPCHandler) LoginGuest(ctx context.Context, req *nexusclashv1.LoginGuestRequest) (*nexusclashv1.LoginGuestResponse, error) {
+	session, err := h.svc.LoginGuest(ctx, req.GetUserId().GetValue(), req.GetDeviceSecret())
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "invalid credentials")
+		}
+		if errors.Is(err, ErrAccountSanctioned) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	return &nexusclashv1.LoginGuestResponse{
+		SessionToken: session.AccessToken,
+		RefreshToken: session.RefreshToken,
+	}, nil
+}
+
+// UpgradeGuest handles the incoming gRPC request for turning the calling guest into a full account.
+func (h *GRPCHandler) UpgradeGuest(ctx context.Context, req *nexusclashv1.UpgradeGuestRequest) (*nexusclashv1.UpgradeGuestResponse, error) {
+	session, err := h.svc.UpgradeGuest(ctx, sessionTokenFromMetadata(ctx), req.GetEmail(), req.GetPassword())
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnauthenticated):
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		case errors.Is(err, ErrEmailRequired), errors.Is(err, ErrPasswordTooShort):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, ErrNotGuest):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, ErrEmailOrUserExists):
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		default:
+			return nil, status.Error(codes.Internal, "an unexpected error occurred")
+		}
+	}
+
+	return &nexusclashv1.UpgradeGuestResponse{
+		SessionToken: session.AccessToken,
+		RefreshToken: session.RefreshToken,
+	}, nil
+}
+
+// VerifySecondFactor handles the incoming gRPC request for the second step of a two-step login.
+func (h *GRPCHandler) VerifySecondFactor(ctx context.Context, req *nexusclashv1.VerifySecondFactorRequest) (*nexusclashv1.VerifySecondFactorResponse, error) {
+	session, err := h.svc.VerifySecondFactor(ctx, req.GetChallengeToken(), req.GetCode(), h.clientIP(ctx))
+	if err != nil {
+		if errors.Is(err, ErrInvalidActionToken) || errors.Is(err, ErrInvalidSecondFactor) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if errors.Is(err, ErrTooManyLoginAttempts) {
+			return nil, retryAfterStatus(err)
+		}
+		if errors.Is(err, ErrAccountSanctioned) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	return &nexusclashv1.VerifySecondFactorResponse{
+		SessionToken: session.AccessToken,
+		RefreshToken: session.RefreshToken,
+	}, nil
+}
+
+// StartFederatedLogin handles the incoming gRPC request for starting a login or link flow at an identity provider.
+func (h *GRPCHandler) StartFederatedLogin(ctx context.Context, req *nexusclashv1.StartFederatedLoginRequest) (*nexusclashv1.StartFederatedLoginResponse, error) {
+	start, err := h.svc.StartFederatedLogin(ctx, req.GetProvider(), req.GetLink(), sessionTokenFromMetadata(ctx))
+	if err != nil {
+		return nil, federationStatus(err)
+	}
+
+	return &nexusclashv1.StartFederatedLoginResponse{
+		AuthorizationUrl: start.AuthorizationURL,
+		FlowToken:        start.FlowToken,
+	}, nil
+}
+
+// CompleteFederatedLogin handles the incoming gRPC request for finishing a federated login.
+func (h *GRPCHandler) CompleteFederatedLogin(ctx context.Context, req *nexusclashv1.CompleteFederatedLoginRequest) (*nexusclashv1.CompleteFederatedLoginResponse, error) {
+	result, err := h.svc.CompleteFederatedLogin(ctx, req.GetProvider(), req.GetCode(), req.GetState(), req.GetFlowToken())
+	if err != nil {
+		return nil, federationStatus(err)
+	}
+
+	if result.Session == nil {
+		return &nexusclashv1.CompleteFederatedLoginResponse{
+			SecondFactorRequired: true,
+			ChallengeToken:       result.ChallengeToken,
+		}, nil
+	}
+
+	return &nexusclashv1.CompleteFederatedLoginResponse{
+		SessionToken: result.Session.AccessToken,
+		RefreshToken: result.Session.RefreshToken,
+	}, nil
+}
+
+// LinkIdentity handles the incoming gRPC request for linking a provider account to the caller.
+func (h *GRPCHandler) LinkIdentity(ctx context.Context, req *nexusclashv1.LinkIdentityRequest) (*nexusclashv1.LinkIdentityResponse, error) {
+	err := h.svc.LinkIdentity(ctx, sessionTokenFromMetadata(ctx), req.GetProvider(), req.GetCode(), req.GetState(), req.GetFlowToken())
+	if err != nil {
+		return nil, federationStatus(err)
+	}
+
+	return &nexusclashv1.LinkIdentityResponse{}, nil
+}
+
+// federationStatus maps the errors of the federated login RPCs to gRPC status codes.
+func federationStatus(err error) error {
+	switch {
+	case errors.Is(err, ErrUnknownProvider):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrUnauthenticated), errors.Is(err, ErrInvalidFederatedLogin):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, ErrIdentityNotLinked):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrIdentityAlreadyLinked), errors.Is(err, ErrProviderAlreadyLinked):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrAccountSanctioned):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return status.Error(codes.Internal, "an unexpected error occurred")
+	}
+}
+
+// EnrollTOTP handles the incoming gRPC request for starting TOTP enrollment.
+func (h *GRPCHandler) EnrollTOTP(ctx context.Context, req *nexusclashv1.EnrollTOTPRequest) (*nexusclashv1.EnrollTOTPResponse, error) {
+	setup, err := h.svc.EnrollTOTP(ctx, sessionTokenFromMetadata(ctx))
+	if err != nil {
+		if errors.Is(err, ErrUnauthenticated) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if errors.Is(err, ErrTOTPAlreadyEnabled) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	return &nexusclashv1.EnrollTOTPResponse{
+		Secret:          setup.Secret,
+		ProvisioningUri: setup.ProvisioningURI,
+	}, nil
+}
+
+// ConfirmTOTP handles the incoming gRPC request for enabling TOTP.
+func (h *GRPCHandler) ConfirmTOTP(ctx context.Context, req *nexusclashv1.ConfirmTOTPRequest) (*nexusclashv1.ConfirmTOTPResponse, error) {
+	recoveryCodes, err := h.svc.ConfirmTOTP(ctx, sessionTokenFromMetadata(ctx), req.GetCode())
+	if err != nil {
+		return nil, totpStatus(err)
+	}
+
+	return &nexusclashv1.ConfirmTOTPResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+// DisableTOTP handles the incoming gRPC request for disabling TOTP.
+func (h *GRPCHandler) DisableTOTP(ctx context.Context, req *nexusclashv1.DisableTOTPRequest) (*nexusclashv1.DisableTOTPResponse, error) {
+	if err := h.svc.DisableTOTP(ctx, sessionTokenFromMetadata(ctx), req.GetCode()); err != nil {
+		return nil, totpStatus(err)
+	}
+
+	return &nexusclashv1.DisableTOTPResponse{}, nil
+}
+
+// totpStatus maps the errors of the TOTP management RPCs to gRPC status codes.
+func totpStatus(err error) error {
+	switch {
+	case errors.Is(err, ErrUnauthenticated):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, ErrInvalidSecondFactor):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrTOTPNotEnrolled), errors.Is(err, ErrTOTPAlreadyEnabled), errors.Is(err, ErrGuestAccount):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Error(codes.Internal, "an unexpected error occurred")
+	}
+}
+
+// VerifyEmail handles the incoming gRPC request for verifying an email address.
+func (h *GRPCHandler) VerifyEmail(ctx context.Context, req *nexusclashv1.VerifyEmailRequest) (*nexusclashv1.VerifyEmailResponse, error) {
+	if err := h.svc.VerifyEmail(ctx, req.GetToken()); err != nil {
+		if errors.Is(err, ErrInvalidActionToken) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	return &nexusclashv1.VerifyEmailResponse{}, nil
+}
+
+// ResendVerificationEmail handles the incoming gRPC request for a new verification email.
+func (h *GRPCHandler) ResendVerificationEmail(ctx context.Context, req *nexusclashv1.ResendVerificationEmailRequest) (*nexusclashv1.ResendVerificationEmailResponse, error) {
+	if err := h.svc.ResendVerificationEmail(ctx, sessionTokenFromMetadata(ctx)); err != nil {
+		if errors.Is(err, ErrUnauthenticated) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if errors.Is(err, ErrEmailAlreadyVerified) || errors.Is(err, ErrGuestAccount) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	return &nexusclashv1.ResendVerificationEmailResponse{}, nil
+}
+
+// RequestPasswordReset handles the incoming gRPC request for a password reset email.
+func (h *GRPCHandler) RequestPasswordReset(ctx context.Context, req *nexusclashv1.RequestPasswordResetRequest) (*nexusclashv1.RequestPasswordResetResponse, error) {
+	if err := h.svc.RequestPasswordReset(ctx, req.GetEmail()); err != nil {
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	return &nexusclashv1.RequestPasswordResetResponse{}, nil
+}
+
+// ResetPassword handles the incoming gRPC request for setting a new password with a reset token.
+func (h *GRPCHandler) ResetPassword(ctx context.Context, req *nexusclashv1.ResetPasswordRequest) (*nexusclashv1.ResetPasswordResponse, error) {
+	if err := h.svc.ResetPassword(ctx, req.GetToken(), req.GetNewPassword()); err != nil {
+		if errors.Is(err, ErrInvalidActionToken) || errors.Is(err, ErrPasswordTooShort) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	return &nexusclashv1.ResetPasswordResponse{}, nil
+}
+
+// ChangePassword handles the incoming gRPC request for changing the caller's password.
+func (h *GRPCHandler) ChangePassword(ctx context.Context, req *nexusclashv1.ChangePasswordRequest) (*nexusclashv1.ChangePasswordResponse, error) {
+	session, err := h.svc.ChangePassword(ctx, sessionTokenFromMetadata(ctx), req.GetCurrentPassword(), req.GetNewPassword())
+	if err != nil {
+		if errors.Is(err, ErrUnauthenticated) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if errors.Is(err, ErrPasswordTooShort) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, ErrIncorrectPassword) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	return &nexusclashv1.ChangePasswordResponse{
+		SessionToken: session.AccessToken,
+		RefreshToken: session.RefreshToken,
+	}, nil
+}
+
+// GrantRole handles the incoming gRPC request for giving a player a staff role.
+func (h *GRPCHandler) GrantRole(ctx context.Context, req *nexusclashv1.GrantRoleRequest) (*nexusclashv1.GrantRoleResponse, error) {
+	if err := h.svc.GrantRole(ctx, sessionTokenFromMetadata(ctx), req.GetUserId().GetValue(), req.GetRole()); err != nil {
+		return nil, roleStatus(err)
+	}
+
+	return &nexusclashv1.GrantRoleResponse{}, nil
+}
+
+// RevokeRole handles the incoming gRPC request for taking a staff role away from a player.
+func (h *GRPCHandler) RevokeRole(ctx context.Context, req *nexusclashv1.RevokeRoleRequest) (*nexusclashv1.RevokeRoleResponse, error) {
+	if err := h.svc.RevokeRole(ctx, sessionTokenFromMetadata(ctx), req.GetUserId().GetValue(), req.GetRole()); err != nil {
+		return nil, roleStatus(err)
+	}
+
+	return &nexusclashv1.RevokeRoleResponse{}, nil
+}
+
+// roleStatus maps the errors of the role management RPCs to gRPC status codes.
+func roleStatus(err error) error {
+	switch {
+	case errors.Is(err, ErrUnauthenticated):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, ErrForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, ErrUnknownRole):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrUserNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, "an unexpected error occurred")
+	}
+}
+
+// BanAccount handles the incoming gRPC request for banning or suspending a player.
+func (h *GRPCHandler) BanAccount(ctx context.Context, req *nexusclashv1.BanAccountRequest) (*nexusclashv1.BanAccountResponse, error) {
+	duration := req.GetDuration().AsDuration()
+	if duration < 0 {
+		return nil, status.Error(codes.InvalidArgument, "duration cannot be negative")
+	}
+
+	sanction, err := h.svc.BanAccount(ctx, sessionTokenFromMetadata(ctx), req.GetUserId().GetValue(), req.GetReason(), duration)
+	if err != nil {
+		return nil, sanctionStatus(err)
+	}
+
+	return &nexusclashv1.BanAccountResponse{Sanction: toSanctionProto(sanction)}, nil
+}
+
+// LiftBan handles the incoming gRPC request for lifting the sanctions of a player.
+func (h *GRPCHandler) LiftBan(ctx context.Context, req *nexusclashv1.LiftBanRequest) (*nexusclashv1.LiftBanResponse, error) {
+	if err := h.svc.LiftBan(ctx, sessionTokenFromMetadata(ctx), req.GetUserId().GetValue()); err != nil {
+		return nil, sanctionStatus(err)
+	}
+
+	return &nexusclashv1.LiftBanResponse{}, nil
+}
+
+// GetActiveSanction handles the incoming gRPC request for looking up a player's current sanction.
+func (h *GRPCHandler) GetActiveSanction(ctx context.Context, req *nexusclashv1.GetActiveSanctionRequest) (*nexusclashv1.GetActiveSanctionResponse, error) {
+	if req.GetUserId().GetValue() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	sanction, err := h.svc.GetActiveSanction(ctx, req.GetUserId().GetValue())
+	if err != nil {
+		if errors.Is(err, ErrSanctionNotFound) {
+			return &nexusclashv1.GetActiveSanctionResponse{}, nil
+		}
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	return &nexusclashv1.GetActiveSanctionResponse{Sanction: toSanctionProto(sanction)}, nil
+}
+
+// sanctionStatus maps the errors of the sanction management RPCs to gRPC status codes.
+func sanctionStatus(err error) error {
+	switch {
+	case errors.Is(err, ErrReasonRequired):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrSanctionNotFound):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return roleStatus(err)
+	}
+}
+
+// toSanctionProto converts a sanction to its protobuf representation.
+func toSanctionProto(sanction *Sanction) *nexusclashv1.Sanction {
+	msg := &nexusclashv1.Sanction{
+		Id:        sanction.ID,
+		UserId:    &nexusclashv1.UUID{Value: sanction.UserID},
+		Type:      sanction.Type,
+		Reason:    sanction.Reason,
+		CreatedAt: timestamppb.New(sanction.CreatedAt),
+	}
+	if sanction.IssuedBy != "" {
+		msg.IssuedBy = &nexusclashv1.UUID{Value: sanction.IssuedBy}
+	}
+	if sanction.ExpiresAt != nil {
+		msg.ExpiresAt = timestamppb.New(*sanction.ExpiresAt)
+	}
+	return msg
+}
+
+// DeleteAccount handles the incoming gRPC request for deleting the caller's account.
+func (h *GRPCHandler) DeleteAccount(ctx context.Context, req *nexusclashv1.DeleteAccountRequest) (*nexusclashv1.DeleteAccountResponse, error) {
+	purgeAfter, err := h.svc.DeleteAccount(ctx, sessionTokenFromMetadata(ctx), req.GetPassword())
+	if err != nil {
+		if errors.Is(err, ErrUnauthenticated) || errors.Is(err, ErrUserNotFound) {
+			return nil, status.Error(codes.Unauthenticated, ErrUnauthenticated.Error())
+		}
+		if errors.Is(err, ErrIncorrectPassword) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	return &nexusclashv1.DeleteAccountResponse{PurgeAfter: timestamppb.New(purgeAfter)}, nil
+}
+
+// ExportUserData handles the incoming gRPC request for exporting the caller's account data.
+func (h *GRPCHandler) ExportUserData(ctx context.Context, req *nexusclashv1.ExportUserDataRequest) (*nexusclashv1.ExportUserDataResponse, error) {
+	export, err := h.svc.ExportUserData(ctx, sessionTokenFromMetadata(ctx))
+	if err != nil {
+		if errors.Is(err, ErrUnauthenticated) || errors.Is(err, ErrUserNotFound) {
+			return nil, status.Error(codes.Unauthenticated, ErrUnauthenticated.Error())
+		}
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	resp := &nexusclashv1.ExportUserDataResponse{
+		UserId:           &nexusclashv1.UUID{Value: export.User.ID},
+		Email:            export.User.Email,
+		Username:         export.User.Username,
+		EmailVerified:    export.User.EmailVerified,
+		IsGuest:          export.User.IsGuest,
+		CreatedAt:        timestamppb.New(export.User.CreatedAt),
+		Roles:            export.Roles,
+		TwoFactorEnabled: export.TwoFactorEnabled,
+	}
+	for _, identity := range export.Identities {
+		resp.Identities = append(resp.Identities, &nexusclashv1.LinkedIdentity{
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+			LinkedAt: timestamppb.New(identity.CreatedAt),
+		})
+	}
+	for _, sanction := range export.Sanctions {
+		resp.Sanctions = append(resp.Sanctions, toSanctionProto(sanction))
+	}
+
+	return resp, nil
+}
+
+// RefreshSession handles the incoming gRPC request for refresh token rotation.
+func (h *GRPCHandler) RefreshSession(ctx context.Context, req *nexusclashv1.RefreshSessionRequest) (*nexusclashv1.RefreshSessionResponse, error) {
+	session, err := h.svc.RefreshSession(ctx, req.GetRefreshToken())
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if errors.Is(err, ErrAccountSanctioned) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	return &nexusclashv1.RefreshSessionResponse{
+		SessionToken: session.AccessToken,
+		RefreshToken: session.RefreshToken,
+	}, nil
+}
+
+// Logout handles the incoming gRPC request for revoking the caller's session.
+func (h *GRPCHandler) Logout(ctx context.Context, req *nexusclashv1.LogoutRequest) (*nexusclashv1.LogoutResponse, error) {
+	if err := h.svc.Logout(ctx, sessionTokenFromMetadata(ctx), req.GetRefreshToken()); err != nil {
+		if errors.Is(err, ErrUnauthenticated) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	return &nexusclashv1.LogoutResponse{}, nil
+}
+
+// RevokeAllSessions handles the incoming gRPC request for revoking all of the caller's sessions.
+func (h *GRPCHandler) RevokeAllSessions(ctx context.Context, req *nexusclashv1.RevokeAllSessionsRequest) (*nexusclashv1.RevokeAllSessionsResponse, error) {
+	if err := h.svc.RevokeAllSessions(ctx, sessionTokenFromMetadata(ctx)); err != nil {
+		if errors.Is(err, ErrUnauthenticated) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	return &nexusclashv1.RevokeAllSessionsResponse{}, nil
+}
+
+// sessionTokenFromMetadata extracts the bearer token that the gateway forwards in the "authorization" metadata.
+func sessionTokenFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ""
+	}
+	scheme, token, found := strings.Cut(values[0], " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// clientIP returns the end user's IP. The gateway forwards it in the "x-forwarded-for" metadata,
+// which is only honoured from trusted proxies; for other callers the peer address of the connection is used.
+func (h *GRPCHandler) clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	var forwardedFor []string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		forwardedFor = md.Get("x-forwarded-for")
+	}
+	return h.trustedProxies.ClientIP(p.Addr.String(), forwardedFor)
+}
+
+// retryAfterStatus builds a ResourceExhausted status carrying a RetryInfo detail,
+// which the gateway turns into a Retry-After header.
+func retryAfterStatus(err error) error {
+	st := status.New(codes.ResourceExhausted, err.Error())
+	var retryErr *RetryAfterError
+	if errors.As(err, &retryErr) {
+		if detailed, detailErr := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryErr.RetryAfter)}); detailErr == nil {
+			st = detailed
+		}
+	}
+	return st.Err()
+}
+
+// maxBatchValidationSize bounds the number of tokens accepted by a single ValidateTokens call.
+const maxBatchValidationSize = 100
+
+// ValidateToken handles the incoming gRPC request for token introspection.
+func (h *GRPCHandler) ValidateToken(ctx context.Context, req *nexusclashv1.ValidateTokenRequest) (*nexusclashv1.ValidateTokenResponse, error) {
+	result, err := h.svc.ValidateToken(ctx, req.GetSessionToken())
+	if err != nil {
+		return nil, status.Error(codes.Internal, "an unexpected error occurred")
+	}
+
+	return toValidateTokenResponse(result), nil
+}
+
+// ValidateTokens handles the incoming gRPC request for batch token introspection.
+func (h *GRPCHandler) ValidateTokens(ctx context.Context, req *nexusclashv1.ValidateTokensRequest) (*nexusclashv1.ValidateTokensResponse, error) {
+	if len(req.GetSessionTokens()) > maxBatchValidationSize {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d tokens can be validated per request", maxBatchValidationSize)
+	}
+
+	results := make([]*nexusclashv1.ValidateTokenResponse, 0, len(req.GetSessionTokens()))
+	for _, token := range req.GetSessionTokens() {
+		result, err := h.svc.ValidateToken(ctx, token)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "an unexpected error occurred")
+		}
+		results = append(results, toValidateTokenResponse(result))
+	}
+
+	return &nexusclashv1.ValidateTokensResponse{Results: results}, nil
+}
+
+// toValidateTokenResponse converts the service-level token status to its protobuf representation.
+func toValidateTokenResponse(result *TokenStatus) *nexusclashv1.ValidateTokenResponse {
+	resp := &nexusclashv1.ValidateTokenResponse{
+		Valid:   result.Valid,
+		Revoked: result.Revoked,
+		Reason:  result.Reason,
+	}
+
+	if result.Claims != nil {
+		resp.Claims = &nexusclashv1.TokenClaims{
+			UserId:        &nexusclashv1.UUID{Value: result.Claims.UserID},
+			Username:      result.Claims.Username,
+			EmailVerified: result.Claims.EmailVerified,
+			Roles:         result.Claims.Roles,
+		}
+		if result.Claims.IssuedAt != nil {
+			resp.Claims.IssuedAt = timestamppb.New(result.Claims.IssuedAt.Time)
+		}
+		if result.Claims.ExpiresAt != nil {
+			resp.Claims.ExpiresAt = timestamppb.New(result.Claims.ExpiresAt.Time)
+		}
+	}
+
+	return resp
+}
+
+// GetJWKS handles the incoming gRPC request for the public signing keys.
+func (h *GRPCHandler) GetJWKS(ctx context.Context, req *nexusclashv1.GetJWKSRequest) (*nexusclashv1.GetJWKSResponse, error) {
+	return &nexusclashv1.GetJWKSResponse{Keys: h.svc.PublicKeys()}, nil
 }
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrGuestAccount is returned by operations that need an email address, which guests do not have yet.
+	ErrGuestAccount = errors.New("guest accounts must be upgraded with an email address first")
+	// ErrEmailRequired is returned when upgrading a guest without an email address.
+	ErrEmailRequired = errors.New("email is required")
+)
+
+// guestUsernamePrefix starts the generated username of every guest. Players can rename themselves later.
+const guestUsernamePrefix = "guest_"
+
+// GuestAccount is returned when a guest is created. The device secret is only shown once and is
+// what the client signs in with, so it must be kept on the device.
+type GuestAccount struct {
+	UserID       string
+	DeviceSecret string
+	Session      *Session
+}
+
+// CreateGuest creates a password-less guest with a generated username and signs them in.
+func (s *service) CreateGuest(ctx context.Context) (*GuestAccount, error) {
+	// The secret is as strong as a refresh token, so like one it is stored with a fast hash.
+	deviceSecret, err := generateRefreshToken()
+	if err != nil {
+		slog.Error("Failed to generate device secret", "error", err)
+		return nil, err
+	}
+
+	// Generated usernames can collide, so retry with a new one on the rare conflict.
+	const maxAttempts = 3
+	for attempt := 1; ; attempt++ {
+		suffix, err := randomHex(5)
+		if err != nil {
+			return nil, err
+		}
+		user := &User{Username: guestUsernamePrefix + suffix, IsGuest: true}
+
+		user.ID, err = s.repo.CreateGuestUser(ctx, user.Username, hashRefreshToken(deviceSecret))
+		if err != nil {
+			if errors.Is(err, ErrEmailOrUserExists) && attempt < maxAttempts {
+				continue
+			}
+			return nil, err
+		}
+
+		session, err := s.issueSession(ctx, user, uuid.New().String(), "")
+		if err != nil {
+			return nil, err
+		}
+
+		slog.Info("New guest created", "userID", user.ID)
+		return &GuestAccount{UserID: user.ID, DeviceSecret: deviceSecret, Session: session}, nil
+	}
+}
+
+// LoginGuest signs a guest in with the device secret returned by CreateGuest.
+// Guests cannot enable two-factor authentication, so there is never a second step.
+func (s *service) LoginGuest(ctx context.Context, userID, deviceSecret string) (*Session, error) {
+	if userID == "" || deviceSecret == "" {
+		return nil, ErrUserNotFound
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// Upgraded guests sign in with their email and password instead, and the secret is gone.
+	if !user.IsGuest || user.DeviceSecretHash == "" ||
+		subtle.ConstantTimeCompare([]byte(hashRefreshToken(deviceSecret)), []byte(user.DeviceSecretHash)) != 1 {
+		return nil, ErrUserNotFound
+	}
+
+	return s.issueSession(ctx, user, uuid.New().String(), "")
+}
+
+// UpgradeGuest attaches an email and password to the calling guest, turning them into a full account.
+// The user ID stays the same, so the profile and stats are kept. The device secret stops working,
+// all existing sessions are revoked, and a new session is returned.
+func (s *service) UpgradeGuest(ctx context.Context, sessionToken, emailAddress, password string) (*Session, error) {
+	claims, err := s.authenticate(ctx, sessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	emailAddress = normalizeEmail(emailAddress)
+	if emailAddress == "" {
+		return nil, ErrEmailRequired
+	}
+	if len(password) < minPasswordLength {
+		return nil, ErrPasswordTooShort
+	}
+
+	user, err := s.repo.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsGuest {
+		return nil, ErrNotGuest
+	}
+
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		slog.Error("Failed to hash password", "error", err)
+		return nil, err
+	}
+
+	if err := s.repo.UpgradeGuestUser(ctx, user.ID, emailAddress, hashedPassword); err != nil {
+		return nil, err
+	}
+	user.Email, user.PasswordHash, user.IsGuest, user.DeviceSecretHash = emailAddress, hashedPassword, false, ""
+
+	if err := s.revokeAllUserSessions(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Guest upgraded to full account", "userID", user.ID)
+
+	// As with registration, a failure to send the email must not fail the upgrade.
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		slog.Error("Failed to send verification email", "userID", user.ID, "error", err)
+	}
+
+	return s.issueSession(ctx, user, uuid.New().String(), "")
+}
@@ -3,11 +3,18 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 
 	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
 )
@@ -37,6 +44,33 @@ func (h *HTTPHandler) writeError(w http.ResponseWriter, code int, message string
 	h.writeJSON(w, code, map[string]string{"error": message})
 }
 
+// withAuthorization forwards the caller's Authorization header to the auth service as gRPC metadata,
+// so that RPCs acting on the caller's own account can authenticate them.
+func withAuthorization(ctx context.Context, r *http.Request) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", r.Header.Get("Authorization"))
+}
+
+// withClientIP forwards the end user's IP to the auth service as gRPC metadata, for per-IP rate limiting.
+// The TrustedProxies.RealIP middleware has already replaced RemoteAddr with the client address.
+func withClientIP(ctx context.Context, r *http.Request) context.Context {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return metadata.AppendToOutgoingContext(ctx, "x-forwarded-for", ip)
+}
+
+// setRetryAfter copies the RetryInfo detail of a gRPC status into a Retry-After header, in whole seconds.
+func setRetryAfter(w http.ResponseWriter, st *status.Status) {
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			seconds := math.Ceil(info.GetRetryDelay().AsDuration().Seconds())
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(seconds, 1))))
+			return
+		}
+	}
+}
+
 // HandleRegister is the HTTP handler for the POST /register endpoint.
 func (h *HTTPHandler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 	var req nexusclashv1.RegisterRequest
@@ -57,6 +91,8 @@ func (h *HTTPHandler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 		switch st.Code() {
 		case codes.AlreadyExists:
 			h.writeError(w, http.StatusConflict, st.Message())
+		case codes.InvalidArgument:
+			h.writeError(w, http.StatusBadRequest, st.Message())
 		default:
 			h.writeError(w, http.StatusInternalServerError, "Registration failed")
 		}
@@ -67,6 +103,7 @@ func (h *HTTPHandler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 }
 
 // HandleLogin is the HTTP handler for the POST /login endpoint.
+// The body carries an "identifier", the player's email address or username, and the "password".
 func (h *HTTPHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	var req nexusclashv1.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -77,12 +114,48 @@ func (h *HTTPHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	resp, err := h.authClient.Login(ctx, &req)
+	resp, err := h.authClient.Login(withClientIP(ctx, r), &req)
 	if err != nil {
 		st, _ := status.FromError(err)
 		switch st.Code() {
 		case codes.NotFound:
 			h.writeError(w, http.StatusUnauthorized, "Invalid credentials")
+		case codes.ResourceExhausted:
+			setRetryAfter(w, st)
+			h.writeError(w, http.StatusTooManyRequests, st.Message())
+		case codes.PermissionDenied:
+			h.writeError(w, http.StatusForbidden, st.Message())
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Login failed")
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleVerifySecondFactor is the HTTP handler for the POST /login/second-factor endpoint.
+func (h *HTTPHandler) HandleVerifySecondFactor(w http.ResponseWriter, r *http.Request) {
+	var req nexusclashv1.VerifySecondFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.authClient.VerifySecondFactor(withClientIP(ctx, r), &req)
+	if err != nil {
+		st, _ := status.FromError(err)
+		switch st.Code() {
+		case codes.Unauthenticated:
+			h.writeError(w, http.StatusUnauthorized, st.Message())
+		case codes.ResourceExhausted:
+			setRetryAfter(w, st)
+			h.writeError(w, http.StatusTooManyRequests, st.Message())
+		case codes.PermissionDenied:
+			h.writeError(w, http.StatusForbidden, st.Message())
 		default:
 			h.writeError(w, http.StatusInternalServerError, "Login failed")
 		}
@@ -91,3 +164,503 @@ func (h *HTTPHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 
 	h.writeJSON(w, http.StatusOK, resp)
 }
+
+// HandleCreateGuest is the HTTP handler for the POST /guest endpoint.
+func (h *HTTPHandler) HandleCreateGuest(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.authClient.CreateGuest(ctx, &nexusclashv1.CreateGuestRequest{})
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to create guest account")
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, resp)
+}
+
+// HandleLoginGuest is the HTTP handler for the POST /guest/login endpoint.
+func (h *HTTPHandler) HandleLoginGuest(w http.ResponseWriter, r *http.Request) {
+	var req nexusclashv1.LoginGuestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.authClient.LoginGuest(ctx, &req)
+	if err != nil {
+		st, _ := status.FromError(err)
+		switch st.Code() {
+		case codes.NotFound:
+			h.writeError(w, http.StatusUnauthorized, "Invalid credentials")
+		case codes.PermissionDenied:
+			h.writeError(w, http.StatusForbidden, st.Message())
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Login failed")
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleUpgradeGuest is the HTTP handler for the POST /guest/upgrade endpoint.
+// The response carries a new session, because all previous sessions are revoked.
+func (h *HTTPHandler) HandleUpgradeGuest(w http.ResponseWriter, r *http.Request) {
+	var req nexusclashv1.UpgradeGuestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.authClient.UpgradeGuest(withAuthorization(ctx, r), &req)
+	if err != nil {
+		st, _ := status.FromError(err)
+		switch st.Code() {
+		case codes.Unauthenticated:
+			h.writeError(w, http.StatusUnauthorized, "Invalid or expired token")
+		case codes.InvalidArgument:
+			h.writeError(w, http.StatusBadRequest, st.Message())
+		case codes.FailedPrecondition, codes.AlreadyExists:
+			h.writeError(w, http.StatusConflict, st.Message())
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Account upgrade failed")
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleEnrollTOTP is the HTTP handler for the POST /totp/enroll endpoint.
+func (h *HTTPHandler) HandleEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.authClient.EnrollTOTP(withAuthorization(ctx, r), &nexusclashv1.EnrollTOTPRequest{})
+	if err != nil {
+		h.writeTOTPError(w, err, "Failed to start two-factor enrollment")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleConfirmTOTP is the HTTP handler for the POST /totp/confirm endpoint.
+func (h *HTTPHandler) HandleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var req nexusclashv1.ConfirmTOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.authClient.ConfirmTOTP(withAuthorization(ctx, r), &req)
+	if err != nil {
+		h.writeTOTPError(w, err, "Failed to enable two-factor authentication")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleDisableTOTP is the HTTP handler for the POST /totp/disable endpoint.
+func (h *HTTPHandler) HandleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	var req nexusclashv1.DisableTOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.authClient.DisableTOTP(withAuthorization(ctx, r), &req); err != nil {
+		h.writeTOTPError(w, err, "Failed to disable two-factor authentication")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeTOTPError translates the gRPC errors of the TOTP management RPCs to HTTP responses.
+func (h *HTTPHandler) writeTOTPError(w http.ResponseWriter, err error, fallback string) {
+	st, _ := status.FromError(err)
+	switch st.Code() {
+	case codes.Unauthenticated:
+		h.writeError(w, http.StatusUnauthorized, "Invalid or expired token")
+	case codes.InvalidArgument:
+		h.writeError(w, http.StatusBadRequest, st.Message())
+	case codes.FailedPrecondition:
+		h.writeError(w, http.StatusConflict, st.Message())
+	default:
+		h.writeError(w, http.StatusInternalServerError, fallback)
+	}
+}
+
+// HandleVerifyEmail is the HTTP handler for the POST /verify-email endpoint.
+func (h *HTTPHandler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req nexusclashv1.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.authClient.VerifyEmail(ctx, &req); err != nil {
+		st, _ := status.FromError(err)
+		switch st.Code() {
+		case codes.InvalidArgument:
+			h.writeError(w, http.StatusBadRequest, st.Message())
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Email verification failed")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleResendVerificationEmail is the HTTP handler for the POST /verify-email/resend endpoint.
+func (h *HTTPHandler) HandleResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.authClient.ResendVerificationEmail(withAuthorization(ctx, r), &nexusclashv1.ResendVerificationEmailRequest{}); err != nil {
+		st, _ := status.FromError(err)
+		switch st.Code() {
+		case codes.Unauthenticated:
+			h.writeError(w, http.StatusUnauthorized, "Invalid or expired token")
+		case codes.FailedPrecondition:
+			h.writeError(w, http.StatusConflict, st.Message())
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Failed to send verification email")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// HandleRequestPasswordReset is the HTTP handler for the POST /password/forgot endpoint.
+// It always responds with 202 Accepted, whether or not the email is registered.
+func (h *HTTPHandler) HandleRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req nexusclashv1.RequestPasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.authClient.RequestPasswordReset(ctx, &req); err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to request password reset")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// HandleResetPassword is the HTTP handler for the POST /password/reset endpoint.
+func (h *HTTPHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req nexusclashv1.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.authClient.ResetPassword(ctx, &req); err != nil {
+		st, _ := status.FromError(err)
+		switch st.Code() {
+		case codes.InvalidArgument:
+			h.writeError(w, http.StatusBadRequest, st.Message())
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Password reset failed")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleChangePassword is the HTTP handler for the POST /password/change endpoint.
+// The response carries a new session, because all previous sessions are revoked.
+func (h *HTTPHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req nexusclashv1.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.authClient.ChangePassword(withAuthorization(ctx, r), &req)
+	if err != nil {
+		st, _ := status.FromError(err)
+		switch st.Code() {
+		case codes.Unauthenticated:
+			h.writeError(w, http.StatusUnauthorized, "Invalid or expired token")
+		case codes.InvalidArgument:
+			h.writeError(w, http.StatusBadRequest, st.Message())
+		case codes.PermissionDenied:
+			h.writeError(w, http.StatusForbidden, st.Message())
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Password change failed")
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleDeleteAccount is the HTTP handler for the POST /account/delete endpoint.
+// The body carries the "password" of players who have one.
+func (h *HTTPHandler) HandleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	var req nexusclashv1.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.authClient.DeleteAccount(withAuthorization(ctx, r), &req)
+	if err != nil {
+		st, _ := status.FromError(err)
+		switch st.Code() {
+		case codes.Unauthenticated:
+			h.writeError(w, http.StatusUnauthorized, "Invalid or expired token")
+		case codes.PermissionDenied:
+			h.writeError(w, http.StatusForbidden, st.Message())
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Account deletion failed")
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleGrantRole is the HTTP handler for the POST /admin/users/{userID}/roles endpoint.
+// The body carries the "role" to grant.
+func (h *HTTPHandler) HandleGrantRole(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	_, err := h.authClient.GrantRole(withAuthorization(ctx, r), &nexusclashv1.GrantRoleRequest{
+		UserId: &nexusclashv1.UUID{Value: chi.URLParam(r, "userID")},
+		Role:   body.Role,
+	})
+	if err != nil {
+		h.writeAdminError(w, err, "Failed to grant role")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRevokeRole is the HTTP handler for the DELETE /admin/users/{userID}/roles/{role} endpoint.
+func (h *HTTPHandler) HandleRevokeRole(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	_, err := h.authClient.RevokeRole(withAuthorization(ctx, r), &nexusclashv1.RevokeRoleRequest{
+		UserId: &nexusclashv1.UUID{Value: chi.URLParam(r, "userID")},
+		Role:   chi.URLParam(r, "role"),
+	})
+	if err != nil {
+		h.writeAdminError(w, err, "Failed to revoke role")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleBanAccount is the HTTP handler for the POST /admin/users/{userID}/ban endpoint.
+// The body carries the "reason" and, for a suspension, "duration_hours". Without a duration the ban is permanent.
+func (h *HTTPHandler) HandleBanAccount(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Reason        string  `json:"reason"`
+		DurationHours float64 `json:"duration_hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	req := &nexusclashv1.BanAccountRequest{
+		UserId: &nexusclashv1.UUID{Value: chi.URLParam(r, "userID")},
+		Reason: body.Reason,
+	}
+	if body.DurationHours != 0 {
+		req.Duration = durationpb.New(time.Duration(body.DurationHours * float64(time.Hour)))
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.authClient.BanAccount(withAuthorization(ctx, r), req)
+	if err != nil {
+		h.writeAdminError(w, err, "Failed to ban account")
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, resp.GetSanction())
+}
+
+// HandleLiftBan is the HTTP handler for the DELETE /admin/users/{userID}/ban endpoint.
+func (h *HTTPHandler) HandleLiftBan(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	_, err := h.authClient.LiftBan(withAuthorization(ctx, r), &nexusclashv1.LiftBanRequest{
+		UserId: &nexusclashv1.UUID{Value: chi.URLParam(r, "userID")},
+	})
+	if err != nil {
+		h.writeAdminError(w, err, "Failed to lift ban")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeAdminError translates the gRPC errors of the role and sanction management RPCs to HTTP responses.
+func (h *HTTPHandler) writeAdminError(w http.ResponseWriter, err error, fallback string) {
+	st, _ := status.FromError(err)
+	switch st.Code() {
+	case codes.Unauthenticated:
+		h.writeError(w, http.StatusUnauthorized, "Invalid or expired token")
+	case codes.PermissionDenied:
+		h.writeError(w, http.StatusForbidden, st.Message())
+	case codes.InvalidArgument:
+		h.writeError(w, http.StatusBadRequest, st.Message())
+	case codes.NotFound:
+		h.writeError(w, http.StatusNotFound, st.Message())
+	case codes.FailedPrecondition:
+		h.writeError(w, http.StatusConflict, st.Message())
+	default:
+		h.writeError(w, http.StatusInternalServerError, fallback)
+	}
+}
+
+// HandleRefresh is the HTTP handler for the POST /refresh endpoint.
+func (h *HTTPHandler) HandleRefresh(w http.ResponseWriter, r *http.Request) {
+	var req nexusclashv1.RefreshSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.authClient.RefreshSession(ctx, &req)
+	if err != nil {
+		st, _ := status.FromError(err)
+		switch st.Code() {
+		case codes.Unauthenticated:
+			h.writeError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+		case codes.PermissionDenied:
+			h.writeError(w, http.StatusForbidden, st.Message())
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Session refresh failed")
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleLogout is the HTTP handler for the POST /logout endpoint.
+// The body may carry the "refresh_token" issued with the session so that it is revoked too.
+func (h *HTTPHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	var req nexusclashv1.LogoutRequest
+	// The body is optional for this endpoint.
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.authClient.Logout(withAuthorization(ctx, r), &req); err != nil {
+		st, _ := status.FromError(err)
+		switch st.Code() {
+		case codes.Unauthenticated:
+			h.writeError(w, http.StatusUnauthorized, "Invalid or expired token")
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Logout failed")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRevokeAllSessions is the HTTP handler for the POST /sessions/revoke-all endpoint.
+func (h *HTTPHandler) HandleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := h.authClient.RevokeAllSessions(withAuthorization(ctx, r), &nexusclashv1.RevokeAllSessionsRequest{}); err != nil {
+		st, _ := status.FromError(err)
+		switch st.Code() {
+		case codes.Unauthenticated:
+			h.writeError(w, http.StatusUnauthorized, "Invalid or expired token")
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Failed to revoke sessions")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleJWKS is the HTTP handler for the GET /.well-known/jwks.json endpoint.
+// It publishes the public keys that verify session tokens, so other services can verify them locally.
+func (h *HTTPHandler) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.authClient.GetJWKS(ctx, &nexusclashv1.GetJWKSRequest{})
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, "Failed to retrieve signing keys")
+		return
+	}
+
+	keys := resp.GetKeys()
+	if keys == nil {
+		keys = []*nexusclashv1.JSONWebKey{}
+	}
+
+	// Keys are rotated well ahead of their use, so verifiers can safely cache the set for a while.
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jsonWebKey is the wire format of a public key in a JSON Web Key Set (RFC 7517).
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+var errJWKSRefreshThrottled = errors.New("JWKS was refreshed too recently")
+
+type cachedKey struct {
+	alg       string
+	publicKey crypto.PublicKey
+}
+
+// JWKSCache resolves the keys of tokens signed by another party from the public keys it publishes
+// at a JWKS URL, such as the ID tokens of an identity provider. Keys are cached for the configured
+// TTL and the set is fetched again early when a token names an unknown key, which happens after
+// a rotation.
+type JWKSCache struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	// minRefreshInterval throttles fetches triggered by unknown key IDs, so that tokens with
+	// made-up "kid" headers cannot be used to flood the JWKS endpoint.
+	minRefreshInterval time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]cachedKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+func NewJWKSCache(url string, ttl time.Duration) *JWKSCache {
+	return &JWKSCache{
+		url:                url,
+		ttl:                ttl,
+		client:             &http.Client{Timeout: 5 * time.Second},
+		minRefreshInterval: 30 * time.Second,
+		keys:               make(map[string]cachedKey),
+	}
+}
+
+// Keyfunc resolves the verification key of a token from its "kid" header.
+// It is meant to be passed to jwt.ParseWithClaims.
+func (c *JWKSCache) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+
+	key, ok, stale := c.lookup(kid)
+	if !ok || stale {
+		if err := c.refresh(); err != nil {
+			// A stale key is still better than failing every request while the endpoint is down.
+			if !ok {
+				return nil, err
+			}
+			if !errors.Is(err, errJWKSRefreshThrottled) {
+				slog.Warn("Using stale JWKS after failed refresh", "url", c.url, "error", err)
+			}
+		} else {
+			key, ok, _ = c.lookup(kid)
+		}
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if key.alg != "" && key.alg != token.Method.Alg() {
+		return nil, fmt.Errorf("token algorithm %q does not match key %q", token.Method.Alg(), kid)
+	}
+	return key.publicKey, nil
+}
+
+func (c *JWKSCache) lookup(kid string) (cachedKey, bool, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key, ok := c.keys[kid]
+	return key, ok, time.Since(c.fetchedAt) > c.ttl
+}
+
+// refresh fetches the key set again, unless a fetch was attempted very recently.
+func (c *JWKSCache) refresh() error {
+	c.mu.Lock()
+	if time.Since(c.lastAttempt) < c.minRefreshInterval {
+		c.mu.Unlock()
+		return errJWKSRefreshThrottled
+	}
+	c.lastAttempt = time.Now()
+	c.mu.Unlock()
+
+	keys, err := c.fetch()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	c.mu.Unlock()
+
+	slog.Info("Refreshed JWKS", "url", c.url, "keys", len(keys))
+	return nil
+}
+
+func (c *JWKSCache) fetch() (map[string]cachedKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching JWKS: unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decoding JWKS: %w", err)
+	}
+
+	keys := make(map[string]cachedKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		publicKey, err := jwk.publicKey()
+		if err != nil {
+			// Unsupported key types are skipped so that they do not hide the usable ones.
+			slog.Warn("Skipping unsupported key in JWKS", "kid", jwk.Kid, "error", err)
+			continue
+		}
+		keys[jwk.Kid] = cachedKey{alg: jwk.Alg, publicKey: publicKey}
+	}
+	return keys, nil
+}
+
+// publicKey converts the JWK into a key usable by the jwt package.
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, errors.New("invalid RSA modulus")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q", k.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil {
+			return nil, errors.New("invalid EC public key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
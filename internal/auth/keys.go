@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
+)
+
+// Supported token signing algorithms, named as in the JWS "alg" header.
+const (
+	AlgorithmEdDSA = "EdDSA" // Ed25519
+	AlgorithmRS256 = "RS256" // RSA PKCS#1 v1.5 with SHA-256
+)
+
+// rsaKeySize is the modulus size used for newly generated RS256 keys.
+const rsaKeySize = 2048
+
+var ErrNoSigningKey = errors.New("no active signing key")
+
+// SigningKey is an asymmetric key pair used to sign and verify tokens.
+// A key is published one refresh interval before it starts signing, so that every replica can
+// verify its tokens by then. It signs new tokens until SignUntil and is kept for verification
+// until VerifyUntil, so that tokens it signed remain valid after the next key takes over.
+type SigningKey struct {
+	ID          string
+	Algorithm   string
+	PrivateKey  crypto.Signer
+	CreatedAt   time.Time
+	SignUntil   time.Time
+	VerifyUntil time.Time
+}
+
+// KeyConfig holds the key rotation settings.
+type KeyConfig struct {
+	Algorithm string
+	// RotationInterval is how long a key is used for signing before a new one replaces it.
+	RotationInterval time.Duration
+	// RetentionPeriod is how long a key stays published after it stops signing.
+	// It must be longer than the lifetime of any token signed with it.
+	RetentionPeriod time.Duration
+	// RefreshInterval is how often keys are reloaded from the database, so that every
+	// replica of the auth service picks up keys rotated by the others. New keys start
+	// signing one interval after they are created, once every replica knows them.
+	RefreshInterval time.Duration
+}
+
+// KeyManager owns the signing keys. Keys are persisted in Postgres so that all replicas
+// share them and restarts do not invalidate issued tokens.
+type KeyManager struct {
+	repo   Repository
+	config KeyConfig
+
+	mu     sync.RWMutex
+	keys   map[string]*SigningKey
+	newest *SigningKey // The newest key of the configured algorithm, which may not sign yet.
+}
+
+func NewKeyManager(repo Repository, config KeyConfig) (*KeyManager, error) {
+	if config.Algorithm != AlgorithmEdDSA && config.Algorithm != AlgorithmRS256 {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", config.Algorithm)
+	}
+	// A key is published for one refresh interval before it signs and is replaced one interval
+	// before it stops, so it must be able to sign for longer than that.
+	if config.RotationInterval <= 2*config.RefreshInterval {
+		return nil, errors.New("key rotation interval must be more than twice the key refresh interval")
+	}
+	return &KeyManager{
+		repo:   repo,
+		config: config,
+		keys:   make(map[string]*SigningKey),
+	}, nil
+}
+
+// Start loads the keys, makes sure one is available for signing and then rotates
+// and reloads them in the background until the context is cancelled.
+func (m *KeyManager) Start(ctx context.Context) error {
+	if err := m.rotateIfNeeded(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(m.config.RefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				slog.Info("Signing key rotation loop stopping.")
+				return
+			case <-ticker.C:
+				if err := m.rotateIfNeeded(ctx); err != nil {
+					slog.Error("Failed to rotate signing keys", "error", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// rotateIfNeeded reloads the keys and generates a new one if no key is active for signing.
+// Keys that are past their verification window are deleted.
+func (m *KeyManager) rotateIfNeeded(ctx context.Context) error {
+	if err := m.repo.DeleteExpiredSigningKeys(ctx); err != nil {
+		return err
+	}
+
+	if err := m.reload(ctx); err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	newest := m.newest
+	m.mu.RUnlock()
+
+	// Rotate ahead of time, so that the new key is published and starts signing before the
+	// current one stops. The check runs every refresh interval, and the new key signs one
+	// interval after it is created.
+	if newest != nil && time.Until(newest.SignUntil) > 2*m.config.RefreshInterval {
+		return nil
+	}
+
+	key, err := m.generateKey()
+	if err != nil {
+		return err
+	}
+	if err := m.repo.CreateSigningKey(ctx, key); err != nil {
+		return err
+	}
+	slog.Info("Generated new signing key", "kid", key.ID, "algorithm", key.Algorithm, "signUntil", key.SignUntil)
+
+	return m.reload(ctx)
+}
+
+// reload replaces the in-memory key set with the keys stored in the database.
+func (m *KeyManager) reload(ctx context.Context) error {
+	stored, err := m.repo.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	keys := make(map[string]*SigningKey, len(stored))
+	var newest *SigningKey
+	for _, key := range stored {
+		if now.After(key.VerifyUntil) {
+			continue
+		}
+		keys[key.ID] = key
+		if key.Algorithm == m.config.Algorithm && (newest == nil || key.CreatedAt.After(newest.CreatedAt)) {
+			newest = key
+		}
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.newest = newest
+	m.mu.Unlock()
+	return nil
+}
+
+// signsFrom returns when a key starts signing: once every replica has reloaded the keys since it
+// was created, so that each of them can verify its tokens.
+func (m *KeyManager) signsFrom(key *SigningKey) time.Time {
+	return key.CreatedAt.Add(m.config.RefreshInterval)
+}
+
+func (m *KeyManager) generateKey() (*SigningKey, error) {
+	var signer crypto.Signer
+	switch m.config.Algorithm {
+	case AlgorithmEdDSA:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		signer = privateKey
+	case AlgorithmRS256:
+		privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+		if err != nil {
+			return nil, err
+		}
+		signer = privateKey
+	}
+
+	now := time.Now()
+	signUntil := now.Add(m.config.RotationInterval)
+	return &SigningKey{
+		ID:          uuid.New().String(),
+		Algorithm:   m.config.Algorithm,
+		PrivateKey:  signer,
+		CreatedAt:   now,
+		SignUntil:   signUntil,
+		VerifyUntil: signUntil.Add(m.config.RetentionPeriod),
+	}, nil
+}
+
+// SigningKey returns the key that new tokens should be signed with: the newest key that every
+// replica has loaded by now. Other algorithms are only kept for verification, which allows
+// switching algorithms without logging players out.
+func (m *KeyManager) SigningKey() (*SigningKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var current, pending *SigningKey
+	for _, key := range m.keys {
+		if key.Algorithm != m.config.Algorithm || !now.Before(key.SignUntil) {
+			continue
+		}
+		if now.Before(m.signsFrom(key)) {
+			if pending == nil || key.CreatedAt.After(pending.CreatedAt) {
+				pending = key
+			}
+		} else if current == nil || key.CreatedAt.After(current.CreatedAt) {
+			current = key
+		}
+	}
+	// Without any published key, as on the very first start, a new key signs right away.
+	if current == nil {
+		current = pending
+	}
+	if current == nil {
+		return nil, ErrNoSigningKey
+	}
+	return current, nil
+}
+
+// Keyfunc resolves the verification key of a token from its "kid" header.
+// It is meant to be passed to jwt.ParseWithClaims.
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	m.mu.RLock()
+	key, ok := m.keys[kid]
+	m.mu.RUnlock()
+
+	if !ok || time.Now().After(key.VerifyUntil) {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	// Pin the algorithm to the key, so a token cannot pick a different one.
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("token algorithm %q does not match key %q", token.Method.Alg(), kid)
+	}
+	return key.PrivateKey.Public(), nil
+}
+
+// ValidMethods lists every algorithm the manager can verify.
+func (m *KeyManager) ValidMethods() []string {
+	return []string{AlgorithmEdDSA, AlgorithmRS256}
+}
+
+// PublicKeys returns the JWKS representation of every key that is valid for verification,
+// newest first.
+func (m *KeyManager) PublicKeys() []*nexusclashv1.JSONWebKey {
+	m.mu.RLock()
+	keys := make([]*SigningKey, 0, len(m.keys))
+	for _, key := range m.keys {
+		keys = append(keys, key)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+
+	jwks := make([]*nexusclashv1.JSONWebKey, 0, len(keys))
+	for _, key := range keys {
+		jwks = append(jwks, key.JWK())
+	}
+	return jwks
+}
+
+// JWK returns the public half of the key as a JSON Web Key (RFC 7517).
+func (k *SigningKey) JWK() *nexusclashv1.JSONWebKey {
+	jwk := &nexusclashv1.JSONWebKey{
+		Kid: k.ID,
+		Alg: k.Algorithm,
+		Use: "sig",
+	}
+	switch publicKey := k.PrivateKey.Public().(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	}
+	return jwk
+}
+
+// encodePrivateKey serializes a private key as a PKCS#8 PEM block for storage.
+func encodePrivateKey(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// decodePrivateKey parses a PKCS#8 PEM block produced by encodePrivateKey.
+func decodePrivateKey(encoded string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, errors.New("invalid PEM encoding of private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrTooManyLoginAttempts is returned while an account or client IP is locked out.
+var ErrTooManyLoginAttempts = errors.New("too many failed login attempts, try again later")
+
+// RetryAfterError wraps an error with the time the caller should wait before retrying.
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string { return e.Err.Error() }
+func (e *RetryAfterError) Unwrap() error { return e.Err }
+
+// LoginLimiterConfig holds the brute-force protection settings.
+type LoginLimiterConfig struct {
+	// Window is the length of the sliding window in which failures are counted.
+	Window time.Duration
+	// MaxAccountFailures is the number of failures within the window that locks an account.
+	MaxAccountFailures int
+	// MaxIPFailures is the number of failures within the window that locks a client IP.
+	// It is higher than the account limit because many players can share an IP behind NAT.
+	MaxIPFailures int
+	// BaseLockout is the duration of the first lockout. Each further lockout doubles it.
+	BaseLockout time.Duration
+	// MaxLockout caps the exponential backoff.
+	MaxLockout time.Duration
+}
+
+// LoginLimiter tracks failed login attempts per account and per client IP.
+type LoginLimiter interface {
+	// Check returns how long the caller must wait before trying again, or zero if it may proceed.
+	Check(ctx context.Context, account, clientIP string) (time.Duration, error)
+	RecordFailure(ctx context.Context, account, clientIP string) error
+	RecordSuccess(ctx context.Context, account string) error
+}
+
+type redisLoginLimiter struct {
+	rdb    *redis.Client
+	config LoginLimiterConfig
+}
+
+func NewLoginLimiter(rdb *redis.Client, config LoginLimiterConfig) LoginLimiter {
+	return &redisLoginLimiter{rdb: rdb, config: config}
+}
+
+// limitSubject is one dimension that failures are counted on, e.g. an account or an IP.
+type limitSubject struct {
+	kind        string
+	value       string
+	maxFailures int
+}
+
+func (s limitSubject) failuresKey() string {
+	return fmt.Sprintf("auth:login_failures:%s:%s", s.kind, s.value)
+}
+
+func (s limitSubject) lockKey() string {
+	return fmt.Sprintf("auth:login_lock:%s:%s", s.kind, s.value)
+}
+
+func (s limitSubject) lockoutsKey() string {
+	return fmt.Sprintf("auth:login_lockouts:%s:%s", s.kind, s.value)
+}
+
+func (l *redisLoginLimiter) subjects(account, clientIP string) []limitSubject {
+	subjects := []limitSubject{{kind: "account", value: account, maxFailures: l.config.MaxAccountFailures}}
+	if clientIP != "" {
+		subjects = append(subjects, limitSubject{kind: "ip", value: clientIP, maxFailures: l.config.MaxIPFailures})
+	}
+	return subjects
+}
+
+// Check reports the longest remaining lockout of the account and the client IP.
+func (l *redisLoginLimiter) Check(ctx context.Context, account, clientIP string) (time.Duration, error) {
+	var retryAfter time.Duration
+	for _, subject := range l.subjects(account, clientIP) {
+		ttl, err := l.rdb.PTTL(ctx, subject.lockKey()).Result()
+		if err != nil {
+			slog.Error("Failed to check login lockout in Redis", "kind", subject.kind, "error", err)
+			return 0, err
+		}
+		// PTTL returns a negative value when the key does not exist.
+		if ttl > retryAfter {
+			retryAfter = ttl
+		}
+	}
+	return retryAfter, nil
+}
+
+// RecordFailure counts a failed attempt in the sliding window of the account and the client IP,
+// and locks whichever of them exceeds its limit.
+func (l *redisLoginLimiter) RecordFailure(ctx context.Context, account, clientIP string) error {
+	for _, subject := range l.subjects(account, clientIP) {
+		if err := l.recordFailure(ctx, subject); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *redisLoginLimiter) recordFailure(ctx context.Context, subject limitSubject) error {
+	now := time.Now()
+	windowStart := now.Add(-l.config.Window)
+	key := subject.failuresKey()
+
+	// The sliding window is a Sorted Set of failure timestamps. Entries older than the window are
+	// trimmed on every write, so ZCARD is the number of failures within the window.
+	pipe := l.rdb.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(windowStart.UnixNano(), 10))
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixNano()), Member: uuid.New().String()})
+	count := pipe.ZCard(ctx, key)
+	pipe.Expire(ctx, key, l.config.Window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Error("Failed to record login failure in Redis", "kind", subject.kind, "error", err)
+		return err
+	}
+
+	if count.Val() < int64(subject.maxFailures) {
+		return nil
+	}
+
+	return l.lock(ctx, subject)
+}
+
+// lock locks the subject with exponential backoff: every lockout within a day doubles the next one.
+func (l *redisLoginLimiter) lock(ctx context.Context, subject limitSubject) error {
+	lockouts, err := l.rdb.Incr(ctx, subject.lockoutsKey()).Result()
+	if err != nil {
+		slog.Error("Failed to count login lockouts in Redis", "kind", subject.kind, "error", err)
+		return err
+	}
+
+	duration := l.config.BaseLockout
+	for i := int64(1); i < lockouts && duration < l.config.MaxLockout; i++ {
+		duration *= 2
+	}
+	if duration > l.config.MaxLockout {
+		duration = l.config.MaxLockout
+	}
+
+	pipe := l.rdb.TxPipeline()
+	pipe.Expire(ctx, subject.lockoutsKey(), 24*time.Hour)
+	pipe.Set(ctx, subject.lockKey(), 1, duration)
+	// Start a fresh window, so the next lockout needs a full set of new failures.
+	pipe.Del(ctx, subject.failuresKey())
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Error("Failed to lock login in Redis", "kind", subject.kind, "error", err)
+		return err
+	}
+
+	slog.Warn("Login temporarily locked after repeated failures", "kind", subject.kind, "value", subject.value, "duration", duration, "lockouts", lockouts)
+	return nil
+}
+
+// RecordSuccess clears the failure history of an account. The IP history is deliberately kept,
+// otherwise an attacker could reset it by periodically logging into an account they own.
+func (l *redisLoginLimiter) RecordSuccess(ctx context.Context, account string) error {
+	subject := limitSubject{kind: "account", value: account}
+	if err := l.rdb.Del(ctx, subject.failuresKey(), subject.lockoutsKey()).Err(); err != nil {
+		slog.Error("Failed to reset login failures in Redis", "error", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
+)
+
+// contextKey is an unexported type for context keys defined in this package.
+// Using a dedicated type prevents collisions with keys defined in other packages.
+type contextKey string
+
+const claimsContextKey contextKey = "auth.claims"
+
+// Middleware authenticates incoming HTTP requests using the auth service's ValidateToken RPC,
+// so the gateway never needs to know the token signing secret.
+type Middleware struct {
+	authClient nexusclashv1.AuthServiceClient
+}
+
+func NewMiddleware(authClient nexusclashv1.AuthServiceClient) *Middleware {
+	return &Middleware{authClient: authClient}
+}
+
+// Authenticate is a chi-compatible middleware that validates the bearer token of the request.
+// Requests with a missing, expired or tampered token are rejected with 401 Unauthorized.
+// On success, the token's claims are stored in the request context.
+func (m *Middleware) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := extractToken(r)
+		if tokenString == "" {
+			writeUnauthorized(w, "Missing bearer token")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		resp, err := m.authClient.ValidateToken(ctx, &nexusclashv1.ValidateTokenRequest{SessionToken: tokenString})
+		if err != nil {
+			slog.Error("Failed to validate token with auth service", "error", err)
+			writeJSONError(w, http.StatusServiceUnavailable, "Authentication is temporarily unavailable")
+			return
+		}
+
+		if !resp.GetValid() {
+			slog.Warn("Rejected request with invalid token", "path", r.URL.Path, "reason", resp.GetReason())
+			writeUnauthorized(w, "Invalid or expired token")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey, resp.GetClaims())))
+	})
+}
+
+// RequireRole returns a chi-compatible middleware that only lets through callers whose token carries
+// at least one of the given roles. It must be mounted after Authenticate; other callers get 403 Forbidden.
+// Services that perform the operation should still check the role themselves, since token claims can be
+// up to one token lifetime out of date.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				writeUnauthorized(w, "Missing bearer token")
+				return
+			}
+			if !HasAnyRole(claims.GetRoles(), roles...) {
+				slog.Warn("Rejected request lacking a required role", "path", r.URL.Path, "userID", claims.GetUserId().GetValue())
+				writeJSONError(w, http.StatusForbidden, "You do not have permission to access this resource")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClaimsFromContext returns the claims of the token validated by Authenticate.
+func ClaimsFromContext(ctx context.Context) (*nexusclashv1.TokenClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*nexusclashv1.TokenClaims)
+	return claims, ok && claims != nil
+}
+
+// UserIDFromContext returns the authenticated user ID stored by Authenticate.
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok || claims.GetUserId().GetValue() == "" {
+		return "", false
+	}
+	return claims.GetUserId().GetValue(), true
+}
+
+// extractToken reads the token from the "Authorization: Bearer <token>" header.
+// Browsers cannot set custom headers on WebSocket handshakes, so for upgrade requests
+// the token may also be passed in the "access_token" query parameter.
+func extractToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return r.URL.Query().Get("access_token")
+	}
+
+	return ""
+}
+
+// writeUnauthorized sends a 401 response with the challenge header required by RFC 6750.
+func writeUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="nexus-clash"`)
+	writeJSONError(w, http.StatusUnauthorized, message)
+}
+
+// writeJSONError sends an error in the same JSON format as the HTTP handlers.
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
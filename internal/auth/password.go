@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/email"
+)
+
+// minPasswordLength is the minimum number of characters of a password.
+const minPasswordLength = 8
+
+var (
+	// ErrPasswordTooShort is returned when a new password does not meet the length requirement.
+	ErrPasswordTooShort = fmt.Errorf("password must be at least %d characters long", minPasswordLength)
+	// ErrIncorrectPassword is returned by ChangePassword when the current password does not match.
+	ErrIncorrectPassword = errors.New("current password is incorrect")
+)
+
+// RequestPasswordReset emails a single-use reset link to the account with the given email.
+// It succeeds even if no such account exists, so that it cannot be used to discover registered emails.
+func (s *service) RequestPasswordReset(ctx context.Context, emailAddress string) error {
+	user, err := s.repo.GetUserByEmail(ctx, normalizeEmail(emailAddress))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			slog.Info("Password reset requested for unknown email")
+			return nil
+		}
+		return err
+	}
+
+	token, err := s.issueActionToken(user, purposeResetPassword, s.config.PasswordResetTokenDuration)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf(s.config.PasswordResetURL, token)
+	err = s.mailer.Send(ctx, email.Message{
+		To:      user.Email,
+		Subject: "Reset your Nexus Clash password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your Nexus Clash account. "+
+			"To choose a new password, open the link below:\n\n%s\n\n"+
+			"The link expires in %s and can be used once. If you did not ask for this, you can ignore this email.\n",
+			user.Username, link, s.config.PasswordResetTokenDuration),
+	})
+	if err != nil {
+		slog.Error("Failed to send password reset email", "userID", user.ID, "error", err)
+		return err
+	}
+
+	slog.Info("Password reset email sent", "userID", user.ID)
+	return nil
+}
+
+// ResetPassword sets a new password using a token from a reset email and signs the user out everywhere.
+func (s *service) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if len(newPassword) < minPasswordLength {
+		return ErrPasswordTooShort
+	}
+
+	claims, err := s.consumeActionToken(ctx, token, purposeResetPassword)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrInvalidActionToken
+		}
+		return err
+	}
+
+	// The token only works for the email and password it was issued for.
+	if user.Email != claims.Email || passwordStamp(user.PasswordHash) != claims.PasswordStamp {
+		return ErrInvalidActionToken
+	}
+
+	if err := s.setPassword(ctx, user.ID, newPassword); err != nil {
+		return err
+	}
+
+	slog.Info("Password reset", "userID", user.ID)
+	return nil
+}
+
+// ChangePassword replaces the caller's password after checking the current one.
+// Every existing session is revoked, and a new session is returned so the caller stays signed in.
+func (s *service) ChangePassword(ctx context.Context, sessionToken, currentPassword, newPassword string) (*Session, error) {
+	claims, err := s.authenticate(ctx, sessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(newPassword) < minPasswordLength {
+		return nil, ErrPasswordTooShort
+	}
+
+	user, err := s.repo.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	match, err := s.hasher.Verify(currentPassword, user.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+	if !match {
+		return nil, ErrIncorrectPassword
+	}
+
+	if err := s.setPassword(ctx, user.ID, newPassword); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Password changed", "userID", user.ID)
+	return s.issueSession(ctx, user, uuid.New().String(), "")
+}
+
+// setPassword stores the hash of a new password and revokes every session of the user,
+// so that anyone who knew the old password is signed out.
+func (s *service) setPassword(ctx context.Context, userID, newPassword string) error {
+	hashedPassword, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		slog.Error("Failed to hash password", "error", err)
+		return err
+	}
+
+	if err := s.repo.UpdatePasswordHash(ctx, userID, hashedPassword); err != nil {
+		return err
+	}
+
+	return s.revokeAllUserSessions(ctx, userID)
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/events"
+	kafkautil "github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
+)
+
+// ProfileConsumer copies the usernames players pick in the player-profile service to their
+// accounts, so that they sign in with the name they see in the game.
+type ProfileConsumer struct {
+	codec *events.Codec
+	repo  Repository
+}
+
+func NewProfileConsumer(codec *events.Codec, repo Repository) *ProfileConsumer {
+	return &ProfileConsumer{
+		codec: codec,
+		repo:  repo,
+	}
+}
+
+// HandleMessage handles a profile_updated event. It is run by a kafka.Runner, which retries
+// failures and dead-letters malformed events. Events may arrive more than once and out of order;
+// renames older than the last applied one are ignored.
+func (pc *ProfileConsumer) HandleMessage(ctx context.Context, msg kafka.Message) error {
+	event := &nexusclashv1.ProfileUpdatedEvent{}
+	envelope, err := pc.codec.Decode(msg.Value, event)
+	if err != nil {
+		return kafkautil.Permanent(err)
+	}
+
+	userID := event.GetUserId().GetValue()
+	if userID == "" || event.GetUsername() == "" {
+		return kafkautil.Permanent(fmt.Errorf("profile_updated event %s lacks a user ID or username", envelope.GetEventId()))
+	}
+
+	updated, err := pc.updateUsername(ctx, userID, event.GetUsername(), envelope.GetOccurredAt().AsTime())
+	if err != nil {
+		return err
+	}
+
+	if updated {
+		slog.Info("Username changed", "userID", userID)
+	} else {
+		slog.Info("Skipping stale rename or deleted account", "userID", userID)
+	}
+	return nil
+}
+
+// updateUsername applies a rename, retrying while another account holds the name. Both services
+// reject names that only differ in case, so the profile service has already given the name up:
+// the renames of different players were merely applied out of order, and the conflict resolves
+// once the other player's rename arrives. It is retried without limit instead of being dead-lettered,
+// which would leave the two services disagreeing about the name.
+func (pc *ProfileConsumer) updateUsername(ctx context.Context, userID, username string, changedAt time.Time) (bool, error) {
+	backoff := time.Second
+	for {
+		updated, err := pc.repo.UpdateUsername(ctx, userID, username, changedAt)
+		if !errors.Is(err, ErrEmailOrUserExists) {
+			return updated, err
+		}
+		slog.Warn("Username is still held by another account, retrying", "userID", userID, "retryIn", backoff)
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+}
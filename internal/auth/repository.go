@@ -5,47 +5,178 @@ import (
 	"database/sql"
 	"errors"
 	"log/slog"
+	"time"
 
 	"github.com/lib/pq" // Used for handling specific PostgreSQL errors
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/events"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/outbox"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
 )
 
 // Custom error variables for clear, service-level error handling.
 var (
-	ErrUserNotFound      = errors.New("user not found")
-	ErrEmailOrUserExists = errors.New("email or username already exists")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrEmailOrUserExists     = errors.New("email or username already exists")
+	ErrRefreshTokenNotFound  = errors.New("refresh token not found")
+	ErrRefreshTokenReused    = errors.New("refresh token has already been used")
+	ErrIdentityNotFound      = errors.New("identity not found")
+	ErrIdentityAlreadyLinked = errors.New("this provider account is already linked to a player")
+	ErrProviderAlreadyLinked = errors.New("an account of this provider is already linked")
+	ErrTOTPNotFound          = errors.New("two-factor authentication is not set up")
+	ErrTOTPAlreadyEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrNotGuest              = errors.New("account is not a guest account")
+	ErrSanctionNotFound      = errors.New("account has no active ban or suspension")
 )
 
 // User is a domain model representing a user, decoupled from the database schema.
 type User struct {
-	ID           string
-	Email        string
-	Username     string
-	PasswordHash string
+	ID            string
+	Email         string // Empty for guests.
+	Username      string
+	PasswordHash  string // Empty for guests and players who only sign in through an identity provider.
+	EmailVerified bool
+	IsGuest       bool
+	// DeviceSecretHash is the SHA-256 of the secret a guest signs in with. Empty for everyone else.
+	DeviceSecretHash string
+	CreatedAt        time.Time
+}
+
+// Identity is a domain model representing an account at an external identity provider linked to a user.
+type Identity struct {
+	ID        string
+	UserID    string
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+// RefreshToken is a domain model representing a stored refresh token.
+type RefreshToken struct {
+	ID        string
+	UserID    string
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// Sanction is a domain model representing a ban or suspension of a user.
+type Sanction struct {
+	ID        string
+	UserID    string
+	Type      string // SanctionBan or SanctionSuspension.
+	Reason    string
+	IssuedBy  string
+	CreatedAt time.Time
+	ExpiresAt *time.Time // Nil for permanent bans.
+}
+
+// TOTPEnrollment is a domain model representing a player's TOTP authenticator.
+type TOTPEnrollment struct {
+	UserID       string
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
 }
 
 // Repository defines the contract for database operations for the auth service.
 type Repository interface {
 	CreateUser(ctx context.Context, email, username, hashedPassword string) (string, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	GetUserByID(ctx context.Context, userID string) (*User, error)
+	MarkEmailVerified(ctx context.Context, userID string) error
+	UpdateUsername(ctx context.Context, userID, username string, changedAt time.Time) (bool, error)
+	UpdatePasswordHash(ctx context.Context, userID, passwordHash string) error
+
+	CreateGuestUser(ctx context.Context, username, deviceSecretHash string) (string, error)
+	UpgradeGuestUser(ctx context.Context, userID, email, passwordHash string) error
+	SoftDeleteUser(ctx context.Context, userID string) (time.Time, error)
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error)
+
+	GetUserRoles(ctx context.Context, userID string) ([]string, error)
+	GrantRole(ctx context.Context, userID, role, grantedBy string) error
+	RevokeRole(ctx context.Context, userID, role string) error
+
+	CreateSanction(ctx context.Context, sanction *Sanction) error
+	GetActiveSanction(ctx context.Context, userID string) (*Sanction, error)
+	LiftSanctions(ctx context.Context, userID, liftedBy string) (int64, error)
+	ListSanctions(ctx context.Context, userID string) ([]*Sanction, error)
+
+	GetUserByIdentity(ctx context.Context, provider, subject string) (*User, error)
+	CreateIdentity(ctx context.Context, identity *Identity) error
+	ListIdentities(ctx context.Context, userID string) ([]*Identity, error)
+	CreateFederatedUser(ctx context.Context, user *User, identity *Identity) (string, error)
+
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, usedTokenID string, next *RefreshToken) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID string) error
+
+	SavePendingTOTP(ctx context.Context, userID, secret string) error
+	GetTOTP(ctx context.Context, userID string) (*TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error)
+	DeleteTOTP(ctx context.Context, userID string) error
+
+	CreateSigningKey(ctx context.Context, key *SigningKey) error
+	ListSigningKeys(ctx context.Context) ([]*SigningKey, error)
+	DeleteExpiredSigningKeys(ctx context.Context) error
+}
+
+// EventTopics are the Kafka topics of the events the repository writes to the outbox.
+type EventTopics struct {
+	UserRegistered    string
+	AccountSanctioned string
+	AccountDeleted    string
 }
 
 type postgresRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	outbox *outbox.PostgresStore
+	topics EventTopics
+	codec  *events.Codec
+}
+
+func NewRepository(db *sql.DB, topics EventTopics, codec *events.Codec) Repository {
+	return &postgresRepository{db: db, outbox: outbox.NewPostgresStore(db), topics: topics, codec: codec}
 }
 
-func NewRepository(db *sql.DB) Repository {
-	return &postgresRepository{db: db}
+// enqueueEvent stores an event in the outbox, within the transaction of the change it announces.
+// Events are keyed by player, so the events of one player stay in order.
+func (r *postgresRepository) enqueueEvent(ctx context.Context, tx *sql.Tx, topic, userID string, event proto.Message) error {
+	payload, err := r.codec.Encode(ctx, event)
+	if err != nil {
+		return err
+	}
+	return r.outbox.Enqueue(ctx, tx, outbox.Message{Topic: topic, Key: []byte(userID), Payload: payload})
 }
 
 // CreateUser inserts a new user record into the database.
 func (r *postgresRepository) CreateUser(ctx context.Context, email, username, hashedPassword string) (string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin user creation", "error", err)
+		return "", err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
 	query := `
 		INSERT INTO users (email, username, password_hash)
 		VALUES ($1, $2, $3)
 		RETURNING id;`
 
 	var userID string
-	err := r.db.QueryRowContext(ctx, query, email, username, hashedPassword).Scan(&userID)
+	err = tx.QueryRowContext(ctx, query, email, username, hashedPassword).Scan(&userID)
 	if err != nil {
 		// Check if the error is a PostgreSQL unique violation.
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
@@ -56,15 +187,23 @@ func (r *postgresRepository) CreateUser(ctx context.Context, email, username, ha
 		return "", err // Return the original error for internal logging.
 	}
 
+	if err := r.enqueueEvent(ctx, tx, r.topics.UserRegistered, userID, &nexusclashv1.UserRegisteredEvent{UserId: &nexusclashv1.UUID{Value: userID}, Username: username}); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
 	return userID, nil
 }
 
 // GetUserByEmail fetches a user record from the database by their email address.
+// Emails are stored in lowercase, so the address must already be normalized, see normalizeEmail.
 func (r *postgresRepository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, email, username, password_hash 
-		FROM users 
-		WHERE email = $1;`
+		SELECT id, COALESCE(email, ''), username, COALESCE(password_hash, ''), email_verified,
+			is_guest, COALESCE(device_secret_hash, ''), created_at
+		FROM users
+		WHERE email = $1 AND deleted_at IS NULL;`
 
 	var user User
 	err := r.db.QueryRowContext(ctx, query, email).Scan(
@@ -72,6 +211,10 @@ func (r *postgresRepository) GetUserByEmail(ctx context.Context, email string) (
 		&user.Email,
 		&user.Username,
 		&user.PasswordHash,
+		&user.EmailVerified,
+		&user.IsGuest,
+		&user.DeviceSecretHash,
+		&user.CreatedAt,
 	)
 
 	if err != nil {
@@ -86,3 +229,880 @@ func (r *postgresRepository) GetUserByEmail(ctx context.Context, email string) (
 
 	return &user, nil
 }
+
+// GetUserByUsername fetches a user record from the database by their username, ignoring case.
+func (r *postgresRepository) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	query := `
+		SELECT id, COALESCE(email, ''), username, COALESCE(password_hash, ''), email_verified,
+			is_guest, COALESCE(device_secret_hash, ''), created_at
+		FROM users
+		WHERE lower(username) = lower($1) AND deleted_at IS NULL;`
+
+	var user User
+	err := r.db.QueryRowContext(ctx, query, username).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Username,
+		&user.PasswordHash,
+		&user.EmailVerified,
+		&user.IsGuest,
+		&user.DeviceSecretHash,
+		&user.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		slog.Error("Failed to get user by username from database", "error", err)
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetUserByID fetches a user record from the database by their ID.
+func (r *postgresRepository) GetUserByID(ctx context.Context, userID string) (*User, error) {
+	query := `
+		SELECT id, COALESCE(email, ''), username, COALESCE(password_hash, ''), email_verified,
+			is_guest, COALESCE(device_secret_hash, ''), created_at
+		FROM users
+		WHERE id = $1 AND deleted_at IS NULL;`
+
+	var user User
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Username,
+		&user.PasswordHash,
+		&user.EmailVerified,
+		&user.IsGuest,
+		&user.DeviceSecretHash,
+		&user.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		slog.Error("Failed to get user by ID from database", "error", err)
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// UpdateUsername applies a rename made at the given time in the player-profile service. Renames
+// older than the last applied one are ignored, so it reports whether the username was changed.
+func (r *postgresRepository) UpdateUsername(ctx context.Context, userID, username string, changedAt time.Time) (bool, error) {
+	query := `
+		UPDATE users
+		SET username = $2, username_changed_at = $3
+		WHERE id = $1 AND deleted_at IS NULL
+			AND (username_changed_at IS NULL OR username_changed_at < $3);`
+
+	result, err := r.db.ExecContext(ctx, query, userID, username, changedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return false, ErrEmailOrUserExists
+		}
+		slog.Error("Failed to update username in database", "userID", userID, "error", err)
+		return false, err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return updated > 0, nil
+}
+
+// MarkEmailVerified records that the user has verified their email address.
+func (r *postgresRepository) MarkEmailVerified(ctx context.Context, userID string) error {
+	query := `
+		UPDATE users
+		SET email_verified = TRUE, email_verified_at = NOW()
+		WHERE id = $1 AND NOT email_verified;`
+
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		slog.Error("Failed to mark email as verified", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// UpdatePasswordHash replaces the stored password hash of a user.
+func (r *postgresRepository) UpdatePasswordHash(ctx context.Context, userID, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $2
+		WHERE id = $1;`
+
+	result, err := r.db.ExecContext(ctx, query, userID, passwordHash)
+	if err != nil {
+		slog.Error("Failed to update password hash", "userID", userID, "error", err)
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// CreateGuestUser inserts a guest without an email or password, who signs in with a device secret.
+func (r *postgresRepository) CreateGuestUser(ctx context.Context, username, deviceSecretHash string) (string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin guest user creation", "error", err)
+		return "", err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO users (username, is_guest, device_secret_hash)
+		VALUES ($1, TRUE, $2)
+		RETURNING id;`
+
+	var userID string
+	err = tx.QueryRowContext(ctx, query, username, deviceSecretHash).Scan(&userID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return "", ErrEmailOrUserExists
+		}
+		slog.Error("Failed to create guest user in database", "error", err)
+		return "", err
+	}
+
+	if err := r.enqueueEvent(ctx, tx, r.topics.UserRegistered, userID, &nexusclashv1.UserRegisteredEvent{UserId: &nexusclashv1.UUID{Value: userID}, Username: username}); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return userID, nil
+}
+
+// UpgradeGuestUser turns a guest into a full account with an email and password. The row is
+// updated in place, so everything keyed by the user ID, like the profile, stays attached.
+// It returns ErrNotGuest if the user does not exist or was already upgraded.
+func (r *postgresRepository) UpgradeGuestUser(ctx context.Context, userID, email, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET email = $2, password_hash = $3, is_guest = FALSE, device_secret_hash = NULL
+		WHERE id = $1 AND is_guest;`
+
+	result, err := r.db.ExecContext(ctx, query, userID, email, passwordHash)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return ErrEmailOrUserExists
+		}
+		slog.Error("Failed to upgrade guest user", "userID", userID, "error", err)
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrNotGuest
+	}
+	return nil
+}
+
+// SoftDeleteUser marks a user as deleted and anonymizes them in a single transaction. Credentials,
+// linked identities and the authenticator are removed and the username is replaced. The deletion
+// is announced with an account_deleted event, upon which the player-profile service anonymizes
+// the profile. The row itself is kept until PurgeDeletedUsers removes it. It returns the deletion time.
+func (r *postgresRepository) SoftDeleteUser(ctx context.Context, userID string) (time.Time, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin account deletion", "error", err)
+		return time.Time{}, err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	// The anonymized username is the whole ID behind a prefix players cannot choose, so it is unique
+	// without revealing anything, and no player can take it in advance.
+	var deletedAt time.Time
+	err = tx.QueryRowContext(ctx, `
+		UPDATE users
+		SET deleted_at = NOW(),
+			username = $2::text || replace(id::text, '-', ''),
+			email = NULL, email_verified = FALSE, email_verified_at = NULL,
+			password_hash = NULL, device_secret_hash = NULL
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING deleted_at;`, userID, deletedUsernamePrefix).Scan(&deletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, ErrUserNotFound
+		}
+		slog.Error("Failed to anonymize user", "userID", userID, "error", err)
+		return time.Time{}, err
+	}
+
+	for _, query := range []string{
+		`DELETE FROM identities WHERE user_id = $1;`,
+		`DELETE FROM totp_recovery_codes WHERE user_id = $1;`,
+		`DELETE FROM user_totp WHERE user_id = $1;`,
+		`UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			slog.Error("Failed to remove personal data of deleted user", "userID", userID, "error", err)
+			return time.Time{}, err
+		}
+	}
+
+	if err := r.enqueueEvent(ctx, tx, r.topics.AccountDeleted, userID, &nexusclashv1.AccountDeletedEvent{UserId: &nexusclashv1.UUID{Value: userID}}); err != nil {
+		return time.Time{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, err
+	}
+	return deletedAt, nil
+}
+
+// PurgeDeletedUsers hard-deletes users that were deleted before the given time. Everything that
+// references them, including their profile, is removed by the foreign keys.
+func (r *postgresRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE deleted_at < $1;`, deletedBefore)
+	if err != nil {
+		slog.Error("Failed to purge deleted users", "error", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetUserRoles fetches the names of the roles assigned to a user, in alphabetical order.
+func (r *postgresRepository) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	query := `
+		SELECT role
+		FROM user_roles
+		WHERE user_id = $1
+		ORDER BY role;`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		slog.Error("Failed to get roles of user", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// GrantRole assigns a role to a user. Granting a role the user already has is a no-op.
+func (r *postgresRepository) GrantRole(ctx context.Context, userID, role, grantedBy string) error {
+	query := `
+		INSERT INTO user_roles (user_id, role, granted_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, role) DO NOTHING;`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, role, grantedBy); err != nil {
+		// Roles are validated before they get here, so a foreign key violation means the user does not exist.
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "foreign_key_violation" {
+			return ErrUserNotFound
+		}
+		slog.Error("Failed to grant role", "userID", userID, "role", role, "error", err)
+		return err
+	}
+	return nil
+}
+
+// RevokeRole removes a role from a user. Revoking a role the user does not have is a no-op.
+func (r *postgresRepository) RevokeRole(ctx context.Context, userID, role string) error {
+	query := `
+		DELETE FROM user_roles
+		WHERE user_id = $1 AND role = $2;`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, role); err != nil {
+		slog.Error("Failed to revoke role", "userID", userID, "role", role, "error", err)
+		return err
+	}
+	return nil
+}
+
+// CreateSanction stores a new ban or suspension and fills in its ID and creation time.
+func (r *postgresRepository) CreateSanction(ctx context.Context, sanction *Sanction) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin sanction creation", "error", err)
+		return err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO account_sanctions (user_id, type, reason, issued_by, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5)
+		RETURNING id, created_at;`
+
+	err = tx.QueryRowContext(ctx, query, sanction.UserID, sanction.Type, sanction.Reason, sanction.IssuedBy, sanction.ExpiresAt).
+		Scan(&sanction.ID, &sanction.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "foreign_key_violation" {
+			return ErrUserNotFound
+		}
+		slog.Error("Failed to create sanction", "userID", sanction.UserID, "error", err)
+		return err
+	}
+
+	event := &nexusclashv1.AccountSanctionedEvent{
+		UserId: &nexusclashv1.UUID{Value: sanction.UserID},
+		Type:   sanction.Type,
+		Reason: sanction.Reason,
+	}
+	if sanction.ExpiresAt != nil {
+		event.ExpiresAt = timestamppb.New(*sanction.ExpiresAt)
+	}
+	if err := r.enqueueEvent(ctx, tx, r.topics.AccountSanctioned, sanction.UserID, event); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetActiveSanction fetches the sanction that currently applies to a user. If several overlap,
+// the one that lasts longest is returned. It returns ErrSanctionNotFound if there is none.
+func (r *postgresRepository) GetActiveSanction(ctx context.Context, userID string) (*Sanction, error) {
+	query := `
+		SELECT id, user_id, type, reason, COALESCE(issued_by::text, ''), created_at, expires_at
+		FROM account_sanctions
+		WHERE user_id = $1 AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY expires_at DESC NULLS FIRST
+		LIMIT 1;`
+
+	var sanction Sanction
+	var expiresAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&sanction.ID,
+		&sanction.UserID,
+		&sanction.Type,
+		&sanction.Reason,
+		&sanction.IssuedBy,
+		&sanction.CreatedAt,
+		&expiresAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSanctionNotFound
+		}
+		slog.Error("Failed to get active sanction from database", "userID", userID, "error", err)
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		sanction.ExpiresAt = &expiresAt.Time
+	}
+
+	return &sanction, nil
+}
+
+// ListSanctions fetches every sanction a user ever received, newest first.
+func (r *postgresRepository) ListSanctions(ctx context.Context, userID string) ([]*Sanction, error) {
+	query := `
+		SELECT id, user_id, type, reason, COALESCE(issued_by::text, ''), created_at, expires_at
+		FROM account_sanctions
+		WHERE user_id = $1
+		ORDER BY created_at DESC;`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		slog.Error("Failed to list sanctions", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sanctions []*Sanction
+	for rows.Next() {
+		var sanction Sanction
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&sanction.ID, &sanction.UserID, &sanction.Type, &sanction.Reason, &sanction.IssuedBy, &sanction.CreatedAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			sanction.ExpiresAt = &expiresAt.Time
+		}
+		sanctions = append(sanctions, &sanction)
+	}
+
+	return sanctions, rows.Err()
+}
+
+// LiftSanctions lifts every active sanction of a user and returns how many were lifted.
+func (r *postgresRepository) LiftSanctions(ctx context.Context, userID, liftedBy string) (int64, error) {
+	query := `
+		UPDATE account_sanctions
+		SET lifted_at = NOW(), lifted_by = NULLIF($2, '')::uuid
+		WHERE user_id = $1 AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW());`
+
+	result, err := r.db.ExecContext(ctx, query, userID, liftedBy)
+	if err != nil {
+		slog.Error("Failed to lift sanctions", "userID", userID, "error", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetUserByIdentity fetches the user linked to a provider account.
+func (r *postgresRepository) GetUserByIdentity(ctx context.Context, provider, subject string) (*User, error) {
+	query := `
+		SELECT u.id, COALESCE(u.email, ''), u.username, COALESCE(u.password_hash, ''), u.email_verified,
+			u.is_guest, COALESCE(u.device_secret_hash, ''), u.created_at
+		FROM identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.provider = $1 AND i.subject = $2 AND u.deleted_at IS NULL;`
+
+	var user User
+	err := r.db.QueryRowContext(ctx, query, provider, subject).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Username,
+		&user.PasswordHash,
+		&user.EmailVerified,
+		&user.IsGuest,
+		&user.DeviceSecretHash,
+		&user.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrIdentityNotFound
+		}
+		slog.Error("Failed to get user by identity from database", "provider", provider, "error", err)
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// CreateIdentity links a provider account to an existing user.
+func (r *postgresRepository) CreateIdentity(ctx context.Context, identity *Identity) error {
+	return insertIdentity(ctx, r.db, identity)
+}
+
+// ListIdentities fetches the provider accounts linked to a user.
+func (r *postgresRepository) ListIdentities(ctx context.Context, userID string) ([]*Identity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, COALESCE(email, ''), created_at
+		FROM identities
+		WHERE user_id = $1
+		ORDER BY created_at;`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		slog.Error("Failed to list identities", "userID", userID, "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []*Identity
+	for rows.Next() {
+		var identity Identity
+		if err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, &identity)
+	}
+
+	return identities, rows.Err()
+}
+
+// CreateFederatedUser creates a user without a password together with the identity it signs in with.
+func (r *postgresRepository) CreateFederatedUser(ctx context.Context, user *User, identity *Identity) (string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin federated user creation", "error", err)
+		return "", err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO users (email, username, email_verified, email_verified_at)
+		VALUES ($1, $2, $3, CASE WHEN $3 THEN NOW() END)
+		RETURNING id;`, user.Email, user.Username, user.EmailVerified).Scan(&userID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return "", ErrEmailOrUserExists
+		}
+		slog.Error("Failed to create federated user in database", "error", err)
+		return "", err
+	}
+
+	identity.UserID = userID
+	if err := insertIdentity(ctx, tx, identity); err != nil {
+		return "", err
+	}
+
+	if err := r.enqueueEvent(ctx, tx, r.topics.UserRegistered, userID, &nexusclashv1.UserRegisteredEvent{UserId: &nexusclashv1.UUID{Value: userID}, Username: user.Username}); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return userID, nil
+}
+
+// CreateRefreshToken stores a newly issued refresh token.
+func (r *postgresRepository) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	return insertRefreshToken(ctx, r.db, token)
+}
+
+// GetRefreshToken fetches a refresh token by the hash of its value.
+func (r *postgresRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	query := `
+		SELECT id, user_id, family_id, token_hash, expires_at, used_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1;`
+
+	var token RefreshToken
+	var usedAt, revokedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&usedAt,
+		&revokedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		slog.Error("Failed to get refresh token from database", "error", err)
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+
+	return &token, nil
+}
+
+// RotateRefreshToken marks a refresh token as used and stores its successor in a single transaction.
+// If the token was already used or revoked by a concurrent request, ErrRefreshTokenReused is returned.
+func (r *postgresRepository) RotateRefreshToken(ctx context.Context, usedTokenID string, next *RefreshToken) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin refresh token rotation", "error", err)
+		return err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	// The conditional update makes rotation atomic: only one request can consume a given token.
+	result, err := tx.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET used_at = NOW()
+		WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL;`, usedTokenID)
+	if err != nil {
+		slog.Error("Failed to mark refresh token as used", "error", err)
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrRefreshTokenReused
+	}
+
+	if err := insertRefreshToken(ctx, tx, next); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeRefreshTokenFamily revokes every token that descends from the same login.
+func (r *postgresRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL;`
+
+	if _, err := r.db.ExecContext(ctx, query, familyID); err != nil {
+		slog.Error("Failed to revoke refresh token family", "familyID", familyID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token belonging to a user.
+func (r *postgresRepository) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL;`
+
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		slog.Error("Failed to revoke refresh tokens of user", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// SavePendingTOTP stores a new, unconfirmed TOTP secret, replacing any previous pending enrollment.
+// It returns ErrTOTPAlreadyEnabled if the user already has a confirmed authenticator.
+func (r *postgresRepository) SavePendingTOTP(ctx context.Context, userID, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_totp.confirmed_at IS NULL;`
+
+	result, err := r.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		slog.Error("Failed to store pending TOTP secret", "userID", userID, "error", err)
+		return err
+	}
+	// The conditional upsert affects no row when a confirmed enrollment exists.
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+// GetTOTP fetches the TOTP enrollment of a user, confirmed or not.
+func (r *postgresRepository) GetTOTP(ctx context.Context, userID string) (*TOTPEnrollment, error) {
+	query := `
+		SELECT user_id, secret, confirmed_at, last_used_step
+		FROM user_totp
+		WHERE user_id = $1;`
+
+	var enrollment TOTPEnrollment
+	var confirmedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&enrollment.UserID,
+		&enrollment.Secret,
+		&confirmedAt,
+		&enrollment.LastUsedStep,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTOTPNotFound
+		}
+		slog.Error("Failed to get TOTP enrollment from database", "userID", userID, "error", err)
+		return nil, err
+	}
+
+	if confirmedAt.Valid {
+		enrollment.ConfirmedAt = &confirmedAt.Time
+	}
+
+	return &enrollment, nil
+}
+
+// ConfirmTOTP activates a pending enrollment and replaces the user's recovery codes in a single transaction.
+func (r *postgresRepository) ConfirmTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin TOTP confirmation", "error", err)
+		return err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE user_totp
+		SET confirmed_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NULL;`, userID, step)
+	if err != nil {
+		slog.Error("Failed to confirm TOTP enrollment", "userID", userID, "error", err)
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1;`, userID); err != nil {
+		slog.Error("Failed to delete old recovery codes", "userID", userID, "error", err)
+		return err
+	}
+
+	for _, codeHash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO totp_recovery_codes (user_id, code_hash)
+			VALUES ($1, $2);`, userID, codeHash); err != nil {
+			slog.Error("Failed to store recovery code", "userID", userID, "error", err)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records the time step of an accepted code. It reports false if that step or a later
+// one was already used, which makes every code single-use even within its validity window.
+func (r *postgresRepository) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	query := `
+		UPDATE user_totp
+		SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2;`
+
+	result, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		slog.Error("Failed to record used TOTP step", "userID", userID, "error", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// UseRecoveryCode redeems a recovery code. It reports false if the code does not exist or was already used.
+func (r *postgresRepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	query := `
+		UPDATE totp_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;`
+
+	result, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		slog.Error("Failed to redeem recovery code", "userID", userID, "error", err)
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// DeleteTOTP removes the authenticator and the recovery codes of a user.
+func (r *postgresRepository) DeleteTOTP(ctx context.Context, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin TOTP removal", "error", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1;`, userID); err != nil {
+		slog.Error("Failed to delete recovery codes", "userID", userID, "error", err)
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1;`, userID); err != nil {
+		slog.Error("Failed to delete TOTP enrollment", "userID", userID, "error", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateSigningKey stores a newly generated signing key.
+func (r *postgresRepository) CreateSigningKey(ctx context.Context, key *SigningKey) error {
+	encoded, err := encodePrivateKey(key.PrivateKey)
+	if err != nil {
+		slog.Error("Failed to encode signing key", "kid", key.ID, "error", err)
+		return err
+	}
+
+	query := `
+		INSERT INTO signing_keys (kid, algorithm, private_key, created_at, sign_until, verify_until)
+		VALUES ($1, $2, $3, $4, $5, $6);`
+
+	_, err = r.db.ExecContext(ctx, query, key.ID, key.Algorithm, encoded, key.CreatedAt, key.SignUntil, key.VerifyUntil)
+	if err != nil {
+		slog.Error("Failed to store signing key", "kid", key.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// ListSigningKeys fetches every stored signing key.
+func (r *postgresRepository) ListSigningKeys(ctx context.Context) ([]*SigningKey, error) {
+	query := `
+		SELECT kid, algorithm, private_key, created_at, sign_until, verify_until
+		FROM signing_keys;`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		slog.Error("Failed to list signing keys", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*SigningKey
+	for rows.Next() {
+		var key SigningKey
+		var encoded string
+		if err := rows.Scan(&key.ID, &key.Algorithm, &encoded, &key.CreatedAt, &key.SignUntil, &key.VerifyUntil); err != nil {
+			return nil, err
+		}
+		if key.PrivateKey, err = decodePrivateKey(encoded); err != nil {
+			// A corrupt key must not prevent the others from loading.
+			slog.Error("Skipping undecodable signing key", "kid", key.ID, "error", err)
+			continue
+		}
+		keys = append(keys, &key)
+	}
+
+	return keys, rows.Err()
+}
+
+// DeleteExpiredSigningKeys removes keys that are past their verification window.
+func (r *postgresRepository) DeleteExpiredSigningKeys(ctx context.Context) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM signing_keys WHERE verify_until < NOW();`); err != nil {
+		slog.Error("Failed to delete expired signing keys", "error", err)
+		return err
+	}
+	return nil
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx, so queries can run inside or outside a transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertRefreshToken(ctx context.Context, db execer, token *RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4);`
+
+	if _, err := db.ExecContext(ctx, query, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt); err != nil {
+		slog.Error("Failed to store refresh token", "error", err)
+		return err
+	}
+	return nil
+}
+
+func insertIdentity(ctx context.Context, db execer, identity *Identity) error {
+	query := `
+		INSERT INTO identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, NULLIF($4, ''));`
+
+	if _, err := db.ExecContext(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			if pqErr.Constraint == "identities_user_provider_key" {
+				return ErrProviderAlreadyLinked
+			}
+			return ErrIdentityAlreadyLinked
+		}
+		slog.Error("Failed to store identity", "provider", identity.Provider, "error", err)
+		return err
+	}
+	return nil
+}
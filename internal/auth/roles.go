@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+)
+
+// Staff roles, as stored in the roles table and carried in the "roles" claim of session tokens.
+// Ordinary players have no role.
+const (
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var (
+	// ErrForbidden is returned when the caller lacks the role an operation requires.
+	ErrForbidden = errors.New("you do not have permission to perform this action")
+	// ErrUnknownRole is returned when granting or revoking a role that does not exist.
+	ErrUnknownRole = errors.New("unknown role")
+)
+
+// HasAnyRole reports whether roles contains at least one of the wanted roles.
+func HasAnyRole(roles []string, wanted ...string) bool {
+	for _, role := range wanted {
+		if slices.Contains(roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantRole gives a user a staff role. Only admins can grant roles.
+// The role shows up in the user's tokens from their next login or refresh.
+func (s *service) GrantRole(ctx context.Context, sessionToken, userID, role string) error {
+	claims, err := s.authorize(ctx, sessionToken, RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if role != RoleModerator && role != RoleAdmin {
+		return ErrUnknownRole
+	}
+
+	if err := s.repo.GrantRole(ctx, userID, role, claims.UserID); err != nil {
+		return err
+	}
+
+	slog.Info("Role granted", "userID", userID, "role", role, "grantedBy", claims.UserID)
+	return nil
+}
+
+// RevokeRole takes a staff role away from a user. Only admins can revoke roles.
+// Tokens issued before keep the role until they expire, so the user's sessions are revoked too.
+func (s *service) RevokeRole(ctx context.Context, sessionToken, userID, role string) error {
+	claims, err := s.authorize(ctx, sessionToken, RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if role != RoleModerator && role != RoleAdmin {
+		return ErrUnknownRole
+	}
+
+	if err := s.repo.RevokeRole(ctx, userID, role); err != nil {
+		return err
+	}
+	if err := s.revokeAllUserSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	slog.Info("Role revoked", "userID", userID, "role", role, "revokedBy", claims.UserID)
+	return nil
+}
+
+// authorize authenticates the caller and checks that they currently hold one of the given roles.
+// Roles are read from the database rather than the token, so a revoked role takes effect immediately.
+func (s *service) authorize(ctx context.Context, sessionToken string, roles ...string) (*Claims, error) {
+	claims, err := s.authenticate(ctx, sessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.repo.GetUserRoles(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !HasAnyRole(current, roles...) {
+		slog.Warn("Rejected request lacking a required role", "userID", claims.UserID, "required", roles)
+		return nil, ErrForbidden
+	}
+	// The returned claims carry the current roles, not the possibly outdated ones from the token.
+	claims.Roles = current
+	return claims, nil
+}
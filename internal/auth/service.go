@@ -2,114 +2,568 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/google/uuid"
 
 	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/email"
 )
 
 // Service defines the contract for the auth business logic.
 type Service interface {
 	Register(ctx context.Context, email, username, password string) (*nexusclashv1.UUID, error)
-	Login(ctx context.Context, email, password string) (string, error)
+	Login(ctx context.Context, identifier, password, clientIP string) (*LoginResult, error)
+	CreateGuest(ctx context.Context) (*GuestAccount, error)
+	LoginGuest(ctx context.Context, userID, deviceSecret string) (*Session, error)
+	UpgradeGuest(ctx context.Context, sessionToken, email, password string) (*Session, error)
+	RefreshSession(ctx context.Context, refreshToken string) (*Session, error)
+	Logout(ctx context.Context, sessionToken, refreshToken string) error
+	RevokeAllSessions(ctx context.Context, sessionToken string) error
+	ValidateToken(ctx context.Context, tokenString string) (*TokenStatus, error)
+	PublicKeys() []*nexusclashv1.JSONWebKey
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerificationEmail(ctx context.Context, sessionToken string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	ChangePassword(ctx context.Context, sessionToken, currentPassword, newPassword string) (*Session, error)
+	EnrollTOTP(ctx context.Context, sessionToken string) (*TOTPSetup, error)
+	ConfirmTOTP(ctx context.Context, sessionToken, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, sessionToken, code string) error
+	VerifySecondFactor(ctx context.Context, challengeToken, code, clientIP string) (*Session, error)
+	StartFederatedLogin(ctx context.Context, provider string, link bool, sessionToken string) (*FederatedLoginStart, error)
+	CompleteFederatedLogin(ctx context.Context, provider, code, state, flowToken string) (*LoginResult, error)
+	LinkIdentity(ctx context.Context, sessionToken, provider, code, state, flowToken string) error
+	GrantRole(ctx context.Context, sessionToken, userID, role string) error
+	RevokeRole(ctx context.Context, sessionToken, userID, role string) error
+	BanAccount(ctx context.Context, sessionToken, userID, reason string, duration time.Duration) (*Sanction, error)
+	LiftBan(ctx context.Context, sessionToken, userID string) error
+	GetActiveSanction(ctx context.Context, userID string) (*Sanction, error)
+	DeleteAccount(ctx context.Context, sessionToken, password string) (time.Time, error)
+	ExportUserData(ctx context.Context, sessionToken string) (*UserDataExport, error)
 }
 
+var (
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired, revoked or reused.
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrUnauthenticated is returned by operations that require a valid session token.
+	ErrUnauthenticated = errors.New("invalid or missing session token")
+	// ErrEmailAlreadyVerified is returned when requesting verification of an already verified email.
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+	// ErrInvalidUsername is returned for usernames players could not sign in with, see NormalizeUsername.
+	ErrInvalidUsername = errors.New("invalid username")
+)
+
+// sessionAudience is the "aud" claim of session tokens. Action tokens use a different audience,
+// so they can never be accepted as a session token.
+const sessionAudience = "nexus-clash:session"
+
 // Config holds the configuration needed by the auth service.
 type Config struct {
-	JWTSecret     string
-	TokenDuration time.Duration
+	TokenDuration        time.Duration
+	RefreshTokenDuration time.Duration
+
+	// VerificationTokenDuration is how long an email verification link stays valid.
+	VerificationTokenDuration time.Duration
+	// VerificationURL is the link sent to players, with a %s placeholder for the token.
+	VerificationURL string
+
+	// PasswordResetTokenDuration is how long a password reset link stays valid.
+	PasswordResetTokenDuration time.Duration
+	// PasswordResetURL is the reset link sent to players, with a %s placeholder for the token.
+	PasswordResetURL string
+
+	// TOTPIssuer is the account issuer shown by authenticator apps.
+	TOTPIssuer string
+	// SecondFactorChallengeDuration is how long a player has to enter their code after the password check.
+	SecondFactorChallengeDuration time.Duration
+
+	// OIDCProviders are the identity providers players can sign in with.
+	OIDCProviders []OIDCProviderConfig
+	// FederatedFlowDuration is how long a player has to sign in at the provider.
+	FederatedFlowDuration time.Duration
+
+	// AccountDeletionGracePeriod is how long a deleted account is kept before it is purged.
+	AccountDeletionGracePeriod time.Duration
+}
+
+// LoginResult is the outcome of a password check. Players with two-factor authentication get
+// a challenge token instead of a session, which they exchange via VerifySecondFactor.
+type LoginResult struct {
+	Session        *Session
+	ChallengeToken string
+}
+
+// Session holds the credentials issued to a player on login or refresh.
+type Session struct {
+	AccessToken  string
+	RefreshToken string
 }
 
 type service struct {
-	repo   Repository
-	config Config
+	repo     Repository
+	sessions SessionStore
+	keys     *KeyManager
+	limiter  LoginLimiter
+	mailer   email.Sender
+	hasher   PasswordHasher
+	config   Config
+
+	providers map[string]*oidcProvider
 }
 
-func NewService(repo Repository, config Config) Service {
+func NewService(repo Repository, sessions SessionStore, keys *KeyManager, limiter LoginLimiter, mailer email.Sender, hasher PasswordHasher, config Config) Service {
+	providers := make(map[string]*oidcProvider, len(config.OIDCProviders))
+	for _, providerConfig := range config.OIDCProviders {
+		providers[providerConfig.Name] = newOIDCProvider(providerConfig)
+	}
+
 	return &service{
-		repo:   repo,
-		config: config,
+		repo:     repo,
+		sessions: sessions,
+		keys:     keys,
+		limiter:  limiter,
+		mailer:   mailer,
+		hasher:   hasher,
+		config:   config,
+
+		providers: providers,
 	}
 }
 
 // Register handles the business logic for creating a new user.
 func (s *service) Register(ctx context.Context, email, username, password string) (*nexusclashv1.UUID, error) {
 	// Here you would add more robust validation (e.g., using a validation library).
-	if email == "" || username == "" || len(password) < 8 {
+	email = normalizeEmail(email)
+	if email == "" || len(password) < minPasswordLength {
 		return nil, errors.New("invalid input: email, username, and password (min 8 chars) are required")
 	}
+	username, err := NormalizeChosenUsername(username)
+	if err != nil {
+		return nil, err
+	}
 
-	// Hash the password using bcrypt, the industry standard for password hashing.
-	// A higher cost means more CPU time is required, making brute-force attacks slower.
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	// Hash the password with the configured hasher. The hash records its own parameters,
+	// so the cost can be raised later without invalidating existing passwords.
+	hashedPassword, err := s.hasher.Hash(password)
 	if err != nil {
 		slog.Error("Failed to hash password", "error", err)
 		return nil, err
 	}
 
-	userID, err := s.repo.CreateUser(ctx, email, username, string(hashedPassword))
+	userID, err := s.repo.CreateUser(ctx, email, username, hashedPassword)
 	if err != nil {
 		// The repository already logged the specific error, so we just return it.
 		return nil, err
 	}
 
 	slog.Info("New user registered successfully", "userID", userID)
+
+	// A failure to send the email must not fail the registration; the player can request a new one.
+	user := &User{ID: userID, Email: email, Username: username}
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		slog.Error("Failed to send verification email", "userID", userID, "error", err)
+	}
 	return &nexusclashv1.UUID{Value: userID}, nil
 }
 
-// Login verifies credentials and returns a JWT on success.
-func (s *service) Login(ctx context.Context, email, password string) (string, error) {
-	user, err := s.repo.GetUserByEmail(ctx, email)
+// normalizeEmail returns the form emails are stored and looked up in.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Login verifies credentials and returns a new session on success, or a second-factor challenge
+// if the player has enabled two-factor authentication. The identifier is the player's email
+// address or username, both matched case-insensitively.
+// Failed attempts are rate limited per account and per client IP.
+func (s *service) Login(ctx context.Context, identifier, password, clientIP string) (*LoginResult, error) {
+	identifier = strings.TrimSpace(identifier)
+	var user *User
+	var err error
+	if strings.Contains(identifier, "@") {
+		user, err = s.repo.GetUserByEmail(ctx, normalizeEmail(identifier))
+	} else {
+		user, err = s.repo.GetUserByUsername(ctx, identifier)
+	}
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+
+	// Failures are counted per account even if it does not exist, so the limiter does not reveal which
+	// accounts are registered. Known accounts are counted by their email like in VerifySecondFactor,
+	// so that alternating between email and username does not double the allowed attempts.
+	account := strings.ToLower(identifier)
+	if user != nil && user.Email != "" {
+		account = user.Email
+	}
+
+	retryAfter, err := s.limiter.Check(ctx, account, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfter > 0 {
+		return nil, &RetryAfterError{Err: ErrTooManyLoginAttempts, RetryAfter: retryAfter}
+	}
+
+	err = ErrUserNotFound
+	if user != nil {
+		// Compare the provided password with the stored hash.
+		// The hasher compares them in constant time without revealing the hash.
+		var match bool
+		match, err = s.hasher.Verify(password, user.PasswordHash)
+		if err == nil && !match {
+			err = ErrUserNotFound // Return the same error as user not found to prevent email enumeration attacks.
+		}
+	}
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			if recordErr := s.limiter.RecordFailure(ctx, account, clientIP); recordErr != nil {
+				return nil, recordErr
+			}
+		}
+		return nil, err
+	}
+
+	// The plaintext password is only available now, so this is the moment to upgrade an outdated hash.
+	if s.hasher.NeedsRehash(user.PasswordHash) {
+		s.rehashPassword(ctx, user, password)
+	}
+
+	required, err := s.secondFactorRequired(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if required {
+		// The failure count is only reset once the second factor is verified too, otherwise
+		// someone who knows the password could guess codes indefinitely.
+		challenge, err := s.issueActionToken(user, purposeSecondFactor, s.config.SecondFactorChallengeDuration)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{ChallengeToken: challenge}, nil
+	}
+
+	if err := s.limiter.RecordSuccess(ctx, account); err != nil {
+		return nil, err
+	}
+
+	// If the password is correct, start a new token family for this login.
+	session, err := s.issueSession(ctx, user, uuid.New().String(), "")
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Session: session}, nil
+}
+
+// rehashPassword replaces an outdated password hash. Failures are only logged, since the login itself succeeded.
+func (s *service) rehashPassword(ctx context.Context, user *User, password string) {
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		slog.Error("Failed to rehash password", "userID", user.ID, "error", err)
+		return
+	}
+	if err := s.repo.UpdatePasswordHash(ctx, user.ID, hashedPassword); err != nil {
+		slog.Error("Failed to store rehashed password", "userID", user.ID, "error", err)
+		return
+	}
+	user.PasswordHash = hashedPassword
+	slog.Info("Upgraded password hash", "userID", user.ID)
+}
+
+// RefreshSession rotates a refresh token: the presented token is consumed and a new session is issued.
+// Presenting a token that was already rotated indicates theft, so the whole token family is revoked.
+func (s *service) RefreshSession(ctx context.Context, refreshToken string) (*Session, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	stored, err := s.repo.GetRefreshToken(ctx, hashRefreshToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if stored.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if stored.UsedAt != nil {
+		s.revokeFamilyOnReuse(ctx, stored)
+		return nil, ErrInvalidRefreshToken
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.repo.GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	session, err := s.issueSession(ctx, user, stored.FamilyID, stored.ID)
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			// Another request consumed the token between our read and the rotation.
+			s.revokeFamilyOnReuse(ctx, stored)
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	slog.Info("Session refreshed", "userID", user.ID)
+	return session, nil
+}
+
+// Logout revokes the given session token and, if provided, the refresh token family issued with it.
+func (s *service) Logout(ctx context.Context, sessionToken, refreshToken string) error {
+	claims, err := s.authenticate(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	if err := s.sessions.RevokeSession(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+
+	if refreshToken != "" {
+		stored, err := s.repo.GetRefreshToken(ctx, hashRefreshToken(refreshToken))
+		if err != nil && !errors.Is(err, ErrRefreshTokenNotFound) {
+			return err
+		}
+		// Never let a caller revoke a refresh token that belongs to someone else.
+		if stored != nil && stored.UserID == claims.UserID {
+			if err := s.repo.RevokeRefreshTokenFamily(ctx, stored.FamilyID); err != nil {
+				return err
+			}
+		}
+	}
+
+	slog.Info("User logged out", "userID", claims.UserID)
+	return nil
+}
+
+// RevokeAllSessions signs the caller out everywhere by revoking all of their session and refresh tokens.
+func (s *service) RevokeAllSessions(ctx context.Context, sessionToken string) error {
+	claims, err := s.authenticate(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+	return s.revokeAllUserSessions(ctx, claims.UserID)
+}
+
+// revokeAllUserSessions revokes every session and refresh token of a user.
+func (s *service) revokeAllUserSessions(ctx context.Context, userID string) error {
+	if err := s.repo.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return err
+	}
+	return s.sessions.RevokeAllSessions(ctx, userID)
+}
+
+// authenticate returns the claims of a valid, unrevoked session token.
+func (s *service) authenticate(ctx context.Context, sessionToken string) (*Claims, error) {
+	result, err := s.ValidateToken(ctx, sessionToken)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Valid {
+		return nil, ErrUnauthenticated
+	}
+	return result.Claims, nil
+}
+
+// revokeFamilyOnReuse revokes every refresh token descending from the same login as the reused token.
+func (s *service) revokeFamilyOnReuse(ctx context.Context, reused *RefreshToken) {
+	slog.Warn("Refresh token reuse detected, revoking token family", "userID", reused.UserID, "familyID", reused.FamilyID)
+	if err := s.repo.RevokeRefreshTokenFamily(ctx, reused.FamilyID); err != nil {
+		slog.Error("Failed to revoke refresh token family", "familyID", reused.FamilyID, "error", err)
+	}
+}
+
+// issueSession creates a session token and a refresh token in the given family.
+// If rotatedTokenID is set, that refresh token is consumed atomically with storing the new one.
+// Every way of signing in ends here, so this is where bans and suspensions are enforced.
+func (s *service) issueSession(ctx context.Context, user *User, familyID, rotatedTokenID string) (*Session, error) {
+	if err := s.checkSanction(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	// Roles are looked up on every login and refresh, so changes reach the player's tokens without signing in again.
+	roles, err := s.repo.GetUserRoles(ctx, user.ID)
 	if err != nil {
-		// The repository handles the ErrUserNotFound case.
+		return nil, err
+	}
+
+	accessToken, claims, err := s.generateJWT(user, roles)
+	if err != nil {
+		return nil, err
+	}
+
+	// Track the token so it can be found by RevokeAllSessions.
+	if err := s.sessions.TrackSession(ctx, user.ID, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		slog.Error("Failed to generate refresh token", "error", err)
+		return nil, err
+	}
+
+	stored := &RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashRefreshToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.config.RefreshTokenDuration),
+	}
+
+	if rotatedTokenID != "" {
+		err = s.repo.RotateRefreshToken(ctx, rotatedTokenID, stored)
+	} else {
+		err = s.repo.CreateRefreshToken(ctx, stored)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// generateRefreshToken returns 256 bits of randomness encoded as URL-safe base64.
+func generateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
-	// Compare the provided password with the stored hash.
-	// This function securely compares them without revealing the hash.
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+// hashRefreshToken returns the hex-encoded SHA-256 of a refresh token.
+// The tokens are high-entropy random values, so a fast hash is sufficient (unlike passwords).
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenStatus is the outcome of validating a session token.
+type TokenStatus struct {
+	Valid   bool
+	Claims  *Claims // Set whenever the signature is authentic, even if the token has expired.
+	Revoked bool
+	Reason  string
+}
+
+// ValidateToken checks a session token and reports its claims and status.
+// An invalid token is not an error; the returned error is reserved for internal failures.
+func (s *service) ValidateToken(ctx context.Context, tokenString string) (*TokenStatus, error) {
+	if tokenString == "" {
+		return &TokenStatus{Reason: "token is empty"}, nil
+	}
+
+	claims, err := parseJWT(tokenString, s.keys.Keyfunc, s.keys.ValidMethods())
 	if err != nil {
-		// If the passwords don't match, bcrypt returns an error.
-		return "", ErrUserNotFound // Return the same error as user not found to prevent email enumeration attacks.
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			// The signature was verified before the expiry check failed, so the claims can be trusted.
+			return &TokenStatus{Claims: claims, Reason: "token has expired"}, nil
+		}
+		return &TokenStatus{Reason: "token is malformed or has an invalid signature"}, nil
+	}
+
+	// Tokens without an ID cannot be checked against the denylist, so they are never accepted.
+	if claims.ID == "" {
+		return &TokenStatus{Claims: claims, Reason: "token has no ID"}, nil
+	}
+
+	// If the denylist cannot be consulted we fail closed rather than accept a possibly revoked token.
+	revoked, err := s.sessions.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return &TokenStatus{Claims: claims, Revoked: true, Reason: "token has been revoked"}, nil
+	}
+
+	sanctioned, err := s.sessions.IsSanctioned(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if sanctioned {
+		return &TokenStatus{Claims: claims, Reason: "account is banned or suspended"}, nil
 	}
 
-	// If the password is correct, generate a JWT.
-	return s.generateJWT(user)
+	return &TokenStatus{Valid: true, Claims: claims}, nil
+}
+
+// PublicKeys returns the keys that verify session tokens, in JWKS form.
+func (s *service) PublicKeys() []*nexusclashv1.JSONWebKey {
+	return s.keys.PublicKeys()
 }
 
 // Claims defines the payload for our JWT.
 type Claims struct {
-	UserID   string `json:"uid"`
-	Username string `json:"uname"`
+	UserID        string   `json:"uid"`
+	Username      string   `json:"uname"`
+	EmailVerified bool     `json:"ev"`
+	Roles         []string `json:"roles,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// generateJWT creates a signed JWT for the given user.
-func (s *service) generateJWT(user *User) (string, error) {
+// generateJWT creates a signed JWT for the given user and roles and returns it along with its claims.
+func (s *service) generateJWT(user *User, roles []string) (string, *Claims, error) {
 	// Define the token's expiration time.
 	expirationTime := time.Now().Add(s.config.TokenDuration)
 
-	// Create the JWT claims, which includes the user ID, username, and standard claims.
+	// Create the JWT claims, which includes the user ID, username, roles, and standard claims.
 	claims := &Claims{
-		UserID:   user.ID,
-		Username: user.Username,
+		UserID:        user.ID,
+		Username:      user.Username,
+		EmailVerified: user.EmailVerified,
+		Roles:         roles,
 		RegisteredClaims: jwt.RegisteredClaims{
 			// In JWT, the expiry time is expressed as unix milliseconds.
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{sessionAudience},
+			// The unique token ID ("jti") is what gets recorded in the denylist on revocation.
+			ID: uuid.New().String(),
 		},
 	}
 
-	// Create the token with the specified signing method and claims.
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := s.signToken(claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return tokenString, claims, nil
+}
+
+// signToken signs any set of claims with the current signing key.
+func (s *service) signToken(claims jwt.Claims) (string, error) {
+	key, err := s.keys.SigningKey()
+	if err != nil {
+		slog.Error("Failed to get signing key", "error", err)
+		return "", err
+	}
+
+	// Create the token with the key's signing method, and name the key in the "kid" header
+	// so that verifiers can pick the matching public key from the JWKS.
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
 
-	// Sign the token with our secret key to create the final JWT string.
-	tokenString, err := token.SignedString([]byte(s.config.JWTSecret))
+	// Sign the token with the private key to create the final JWT string.
+	tokenString, err := token.SignedString(key.PrivateKey)
 	if err != nil {
 		slog.Error("Failed to sign JWT", "error", err)
 		return "", err
@@ -117,3 +571,35 @@ func (s *service) generateJWT(user *User) (string, error) {
 
 	return tokenString, nil
 }
+
+// parseJWT verifies the signature, expiry and audience of a session token and returns its claims.
+// Only the given asymmetric methods are accepted, which prevents algorithm-confusion attacks
+// such as "alg: none" or HS256 signed with a public key.
+func parseJWT(tokenString string, keyfunc jwt.Keyfunc, validMethods []string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, keyfunc,
+		jwt.WithValidMethods(validMethods), jwt.WithExpirationRequired(), jwt.WithAudience(sessionAudience))
+	if err != nil && !(errors.Is(err, jwt.ErrTokenExpired) && onlyExpired(claims)) {
+		return nil, err
+	}
+
+	if claims.UserID == "" {
+		return nil, errors.New("token is missing the user ID claim")
+	}
+
+	// Claims are only validated after the signature, so an expired token still has authentic
+	// claims, which callers may want to inspect.
+	return claims, err
+}
+
+// onlyExpired reports whether the claims of an expired token pass every other check, by
+// validating them as of just before their expiry. A token that has expired and is also, say,
+// meant for another audience is rejected outright.
+func onlyExpired(claims *Claims) bool {
+	if claims.ExpiresAt == nil {
+		return false
+	}
+	validator := jwt.NewValidator(jwt.WithExpirationRequired(), jwt.WithAudience(sessionAudience),
+		jwt.WithTimeFunc(func() time.Time { return claims.ExpiresAt.Add(-time.Nanosecond) }))
+	return validator.Validate(claims) == nil
+}
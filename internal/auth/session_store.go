@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SessionStore tracks issued session tokens by their "jti" claim and records revocations.
+// Revoked IDs are kept only for the remaining lifetime of the token, after which the
+// token is rejected for having expired anyway.
+type SessionStore interface {
+	TrackSession(ctx context.Context, userID, tokenID string, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, tokenID string, expiresAt time.Time) error
+	RevokeAllSessions(ctx context.Context, userID string) error
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+	// ConsumeTokenID marks a single-use token ID as used. It reports false if it was used before.
+	ConsumeTokenID(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error)
+	// MarkSanctioned makes token validation reject every token of a user for the given duration.
+	MarkSanctioned(ctx context.Context, userID string, ttl time.Duration) error
+	ClearSanction(ctx context.Context, userID string) error
+	IsSanctioned(ctx context.Context, userID string) (bool, error)
+}
+
+type redisSessionStore struct {
+	rdb *redis.Client
+}
+
+func NewSessionStore(rdb *redis.Client) SessionStore {
+	return &redisSessionStore{rdb: rdb}
+}
+
+func revokedTokenKey(tokenID string) string {
+	return fmt.Sprintf("auth:revoked_jti:%s", tokenID)
+}
+
+func usedTokenKey(tokenID string) string {
+	return fmt.Sprintf("auth:used_jti:%s", tokenID)
+}
+
+func userSessionsKey(userID string) string {
+	return fmt.Sprintf("auth:user_sessions:%s", userID)
+}
+
+func sanctionedUserKey(userID string) string {
+	return fmt.Sprintf("auth:sanctioned:%s", userID)
+}
+
+// TrackSession records a token in the user's session set (a Redis Sorted Set scored by expiry),
+// so that RevokeAllSessions can find every token that is still live.
+func (s *redisSessionStore) TrackSession(ctx context.Context, userID, tokenID string, expiresAt time.Time) error {
+	key := userSessionsKey(userID)
+	pipe := s.rdb.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(expiresAt.Unix()), Member: tokenID})
+	// Expired tokens are dropped, so the set of an active account does not grow with every login.
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(time.Now().Unix(), 10))
+	// All tokens share the same lifetime, so the newest one always expires last.
+	pipe.ExpireAt(ctx, key, expiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Error("Failed to track session in Redis", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// RevokeSession adds a token ID to the denylist until the token expires.
+func (s *redisSessionStore) RevokeSession(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil // The token has already expired, so there is nothing to revoke.
+	}
+	if err := s.rdb.Set(ctx, revokedTokenKey(tokenID), 1, ttl).Err(); err != nil {
+		slog.Error("Failed to revoke session in Redis", "tokenID", tokenID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// RevokeAllSessions adds every live token of a user to the denylist.
+func (s *redisSessionStore) RevokeAllSessions(ctx context.Context, userID string) error {
+	key := userSessionsKey(userID)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	// Only tokens that have not expired yet need a denylist entry.
+	sessions, err := s.rdb.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: now, Max: "+inf"}).Result()
+	if err != nil {
+		slog.Error("Failed to list sessions in Redis", "userID", userID, "error", err)
+		return err
+	}
+
+	pipe := s.rdb.TxPipeline()
+	for _, session := range sessions {
+		tokenID, _ := session.Member.(string)
+		ttl := time.Until(time.Unix(int64(session.Score), 0))
+		if tokenID == "" || ttl <= 0 {
+			continue
+		}
+		pipe.Set(ctx, revokedTokenKey(tokenID), 1, ttl)
+	}
+	pipe.Del(ctx, key)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.Error("Failed to revoke all sessions in Redis", "userID", userID, "error", err)
+		return err
+	}
+
+	slog.Info("Revoked all sessions", "userID", userID, "count", len(sessions))
+	return nil
+}
+
+// IsRevoked reports whether a token ID is on the denylist.
+func (s *redisSessionStore) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	n, err := s.rdb.Exists(ctx, revokedTokenKey(tokenID)).Result()
+	if err != nil {
+		slog.Error("Failed to check token revocation in Redis", "tokenID", tokenID, "error", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ConsumeTokenID atomically records a token ID as used until the token expires.
+func (s *redisSessionStore) ConsumeTokenID(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return false, nil
+	}
+	firstUse, err := s.rdb.SetNX(ctx, usedTokenKey(tokenID), 1, ttl).Result()
+	if err != nil {
+		slog.Error("Failed to consume token ID in Redis", "tokenID", tokenID, "error", err)
+		return false, err
+	}
+	return firstUse, nil
+}
+
+// MarkSanctioned flags a user as banned or suspended for the given duration.
+func (s *redisSessionStore) MarkSanctioned(ctx context.Context, userID string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	if err := s.rdb.Set(ctx, sanctionedUserKey(userID), 1, ttl).Err(); err != nil {
+		slog.Error("Failed to mark user as sanctioned in Redis", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// ClearSanction removes the flag set by MarkSanctioned.
+func (s *redisSessionStore) ClearSanction(ctx context.Context, userID string) error {
+	if err := s.rdb.Del(ctx, sanctionedUserKey(userID)).Err(); err != nil {
+		slog.Error("Failed to clear sanction in Redis", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// IsSanctioned reports whether a user is flagged as banned or suspended.
+func (s *redisSessionStore) IsSanctioned(ctx context.Context, userID string) (bool, error) {
+	n, err := s.rdb.Exists(ctx, sanctionedUserKey(userID)).Result()
+	if err != nil {
+		slog.Error("Failed to check sanction in Redis", "userID", userID, "error", err)
+		return false, err
+	}
+	return n > 0, nil
+}
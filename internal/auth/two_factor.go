@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidSecondFactor is returned when a TOTP or recovery code is wrong or was already used.
+	ErrInvalidSecondFactor = errors.New("invalid or already used verification code")
+	// ErrTOTPNotEnrolled is returned when confirming or disabling TOTP without an enrollment.
+	ErrTOTPNotEnrolled = errors.New("two-factor authentication has not been set up")
+)
+
+// TOTPSetup is the information a player needs to add the account to an authenticator app.
+type TOTPSetup struct {
+	Secret string
+	// ProvisioningURI is the otpauth:// URI, meant to be shown as a QR code.
+	ProvisioningURI string
+}
+
+// EnrollTOTP starts two-factor enrollment for the caller by generating a new secret.
+// The enrollment only takes effect once ConfirmTOTP proves the authenticator works.
+func (s *service) EnrollTOTP(ctx context.Context, sessionToken string) (*TOTPSetup, error) {
+	claims, err := s.authenticate(ctx, sessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	// A guest's only credential is the device secret, which a second factor would add nothing to.
+	if user.IsGuest {
+		return nil, ErrGuestAccount
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		slog.Error("Failed to generate TOTP secret", "error", err)
+		return nil, err
+	}
+
+	if err := s.repo.SavePendingTOTP(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	slog.Info("TOTP enrollment started", "userID", user.ID)
+	return &TOTPSetup{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(s.config.TOTPIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the caller submits a valid code from
+// their authenticator. It returns the recovery codes, which are shown to the player only once.
+func (s *service) ConfirmTOTP(ctx context.Context, sessionToken, code string) ([]string, error) {
+	claims, err := s.authenticate(ctx, sessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	enrollment, err := s.repo.GetTOTP(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, ErrTOTPNotFound) {
+			return nil, ErrTOTPNotEnrolled
+		}
+		return nil, err
+	}
+	if enrollment.ConfirmedAt != nil {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	step, ok := verifyTOTP(enrollment.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidSecondFactor
+	}
+
+	recoveryCodes, err := generateRecoveryCodes()
+	if err != nil {
+		slog.Error("Failed to generate recovery codes", "error", err)
+		return nil, err
+	}
+	hashes := make([]string, 0, len(recoveryCodes))
+	for _, recoveryCode := range recoveryCodes {
+		hashes = append(hashes, hashRecoveryCode(recoveryCode))
+	}
+
+	if err := s.repo.ConfirmTOTP(ctx, claims.UserID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	slog.Info("TOTP enabled", "userID", claims.UserID)
+	return recoveryCodes, nil
+}
+
+// DisableTOTP turns two-factor authentication off. A current TOTP or recovery code is required,
+// so that a stolen session token alone cannot remove the second factor.
+func (s *service) DisableTOTP(ctx context.Context, sessionToken, code string) error {
+	claims, err := s.authenticate(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	enrollment, err := s.repo.GetTOTP(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, ErrTOTPNotFound) {
+			return ErrTOTPNotEnrolled
+		}
+		return err
+	}
+
+	// A pending enrollment has no codes yet, so it can be discarded without one.
+	if enrollment.ConfirmedAt != nil {
+		if err := s.checkSecondFactor(ctx, enrollment, code); err != nil {
+			return err
+		}
+	}
+
+	if err := s.repo.DeleteTOTP(ctx, claims.UserID); err != nil {
+		return err
+	}
+
+	slog.Info("TOTP disabled", "userID", claims.UserID)
+	return nil
+}
+
+// VerifySecondFactor completes a two-step login: it exchanges the challenge returned by Login
+// and a TOTP or recovery code for a session. Wrong codes count as failed logins, so guessing
+// codes is rate limited like guessing passwords.
+func (s *service) VerifySecondFactor(ctx context.Context, challengeToken, code, clientIP string) (*Session, error) {
+	claims, err := s.parseActionToken(challengeToken, purposeSecondFactor)
+	if err != nil {
+		return nil, err
+	}
+	account := normalizeEmail(claims.Email)
+
+	retryAfter, err := s.limiter.Check(ctx, account, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfter > 0 {
+		return nil, &RetryAfterError{Err: ErrTooManyLoginAttempts, RetryAfter: retryAfter}
+	}
+
+	user, err := s.repo.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidActionToken
+		}
+		return nil, err
+	}
+	// A password change since the first step invalidates the challenge.
+	if passwordStamp(user.PasswordHash) != claims.PasswordStamp {
+		return nil, ErrInvalidActionToken
+	}
+
+	enrollment, err := s.repo.GetTOTP(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, ErrTOTPNotFound) {
+			return nil, ErrInvalidActionToken
+		}
+		return nil, err
+	}
+
+	if err := s.checkSecondFactor(ctx, enrollment, code); err != nil {
+		if errors.Is(err, ErrInvalidSecondFactor) {
+			if recordErr := s.limiter.RecordFailure(ctx, account, clientIP); recordErr != nil {
+				return nil, recordErr
+			}
+		}
+		return nil, err
+	}
+
+	// The challenge is only used up on success, so a mistyped code does not force a new password check.
+	if err := s.markActionTokenUsed(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	if err := s.limiter.RecordSuccess(ctx, account); err != nil {
+		return nil, err
+	}
+
+	return s.issueSession(ctx, user, uuid.New().String(), "")
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code, and uses it up.
+func (s *service) checkSecondFactor(ctx context.Context, enrollment *TOTPEnrollment, code string) error {
+	if isRecoveryCode(code) {
+		ok, err := s.repo.UseRecoveryCode(ctx, enrollment.UserID, hashRecoveryCode(code))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidSecondFactor
+		}
+		slog.Info("Recovery code redeemed", "userID", enrollment.UserID)
+		return nil
+	}
+
+	step, ok := verifyTOTP(enrollment.Secret, code, time.Now())
+	if !ok {
+		return ErrInvalidSecondFactor
+	}
+	// Codes stay valid for a whole time step, so the step is recorded to reject replays.
+	fresh, err := s.repo.UseTOTPStep(ctx, enrollment.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidSecondFactor
+	}
+	return nil
+}
+
+// secondFactorRequired reports whether the user has a confirmed authenticator.
+func (s *service) secondFactorRequired(ctx context.Context, userID string) (bool, error) {
+	enrollment, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrTOTPNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return enrollment.ConfirmedAt != nil, nil
+}
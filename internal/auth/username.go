@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Usernames are limited to the size of the username columns, and need a few characters to be told apart.
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 50
+)
+
+// deletedUsernamePrefix starts the username of every deleted account, followed by its ID in hex,
+// see SoftDeleteUser.
+const deletedUsernamePrefix = "deleted_"
+
+// reservedUsernamePrefixes start the names the services generate for guests and deleted accounts.
+// Players cannot choose them, so a generated name is never taken by a player.
+var reservedUsernamePrefixes = []string{guestUsernamePrefix, deletedUsernamePrefix}
+
+// NormalizeUsername trims a username and checks that players can sign in with it. It is shared by
+// every service that stores usernames, so that a name accepted by one is accepted by all of them.
+func NormalizeUsername(username string) (string, error) {
+	username = strings.TrimSpace(username)
+	if n := utf8.RuneCountInString(username); n < MinUsernameLength || n > MaxUsernameLength {
+		return "", fmt.Errorf("%w: must be between %d and %d characters", ErrInvalidUsername, MinUsernameLength, MaxUsernameLength)
+	}
+	// Login tells emails and usernames apart by the "@".
+	if strings.Contains(username, "@") {
+		return "", fmt.Errorf("%w: must not contain '@'", ErrInvalidUsername)
+	}
+	return username, nil
+}
+
+// NormalizeChosenUsername is NormalizeUsername for names picked by a player, which must not start
+// with a reserved prefix in any case.
+func NormalizeChosenUsername(username string) (string, error) {
+	username, err := NormalizeUsername(username)
+	if err != nil {
+		return "", err
+	}
+	for _, prefix := range reservedUsernamePrefixes {
+		if strings.HasPrefix(strings.ToLower(username), prefix) {
+			return "", fmt.Errorf("%w: must not start with %q", ErrInvalidUsername, prefix)
+		}
+	}
+	return username, nil
+}
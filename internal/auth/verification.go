@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/email"
+)
+
+// VerifyEmail marks the email address of the token's user as verified.
+// New session tokens carry the verified flag; existing ones are updated on their next refresh.
+func (s *service) VerifyEmail(ctx context.Context, token string) error {
+	claims, err := s.consumeActionToken(ctx, token, purposeVerifyEmail)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrInvalidActionToken
+		}
+		return err
+	}
+
+	// The token proves ownership of the address it was sent to, not of whatever the address is now.
+	if user.Email != claims.Email {
+		return ErrInvalidActionToken
+	}
+
+	if err := s.repo.MarkEmailVerified(ctx, user.ID); err != nil {
+		return err
+	}
+
+	slog.Info("Email verified", "userID", user.ID)
+	return nil
+}
+
+// ResendVerificationEmail sends a fresh verification email to the caller.
+func (s *service) ResendVerificationEmail(ctx context.Context, sessionToken string) error {
+	claims, err := s.authenticate(ctx, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if user.IsGuest {
+		return ErrGuestAccount
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	return s.sendVerificationEmail(ctx, user)
+}
+
+// sendVerificationEmail emails the user a link containing a single-use verification token.
+func (s *service) sendVerificationEmail(ctx context.Context, user *User) error {
+	token, err := s.issueActionToken(user, purposeVerifyEmail, s.config.VerificationTokenDuration)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf(s.config.VerificationURL, token)
+	return s.mailer.Send(ctx, email.Message{
+		To:      user.Email,
+		Subject: "Verify your Nexus Clash email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %s. If you did not create a Nexus Clash account, you can ignore this email.\n",
+			user.Username, link, s.config.VerificationTokenDuration),
+	})
+}
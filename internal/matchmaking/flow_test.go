@@ -0,0 +1,185 @@
+package matchmaking_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/cheildo/nexus-clash-backend/internal/apigateway"
+	"github.com/cheildo/nexus-clash-backend/internal/matchmaking"
+	"github.com/cheildo/nexus-clash-backend/internal/orchestration"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/events"
+	kafkautil "github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
+)
+
+const (
+	matchFoundTopic  = "match_found_events"
+	serverReadyTopic = "game_server_ready_events"
+)
+
+// connectPlayer registers a WebSocket for the player with the connection manager and returns
+// the client end of it.
+func connectPlayer(t *testing.T, cm *apigateway.ConnectionManager, playerID string) *websocket.Conn {
+	t.Helper()
+	registered := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade: %v", err)
+			return
+		}
+		cm.Add(playerID, conn)
+		close(registered)
+	}))
+	t.Cleanup(server.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	<-registered
+	return client
+}
+
+// fetch fetches the next message, failing the test if none arrives in time.
+func fetch(t *testing.T, s kafkautil.Subscriber) kafka.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := s.FetchMessage(ctx)
+	if err != nil {
+		t.Fatalf("FetchMessage: %v", err)
+	}
+	return msg
+}
+
+// TestMatchFlowOverMemoryBus runs matchmaking, orchestration and the gateway's match consumer
+// without Redis or Kafka. The orchestrator stops after provisioning a server but before committing
+// the match_found event, so the event is redelivered to its group, and must not start a second server.
+func TestMatchFlowOverMemoryBus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bus := kafkautil.NewMemoryBus(3)
+	codec := events.NewCodec(events.FormatJSON)
+	players := []string{uuid.NewString(), uuid.NewString()}
+
+	cm := apigateway.NewConnectionManager()
+	clients := make([]*websocket.Conn, len(players))
+	for i, playerID := range players {
+		clients[i] = connectPlayer(t, cm, playerID)
+	}
+	// Observes the server events in a group of its own.
+	serverReady := bus.Subscribe(serverReadyTopic, "test")
+
+	pool := matchmaking.NewMemoryPool(bus)
+	for _, playerID := range players {
+		if err := pool.AddPlayer(ctx, playerID); err != nil {
+			t.Fatalf("AddPlayer: %v", err)
+		}
+	}
+	matchmaking.NewService(pool, codec, matchFoundTopic, 10*time.Millisecond, len(players)).Start(ctx)
+
+	listener := orchestration.NewListener(bus, events.NewMemoryProcessedStore(), codec, serverReadyTopic, 0, time.Second)
+
+	// The first orchestrator instance provisions the server and stops before committing.
+	crashed := bus.Subscribe(matchFoundTopic, "orchestrator_group")
+	matchFound := fetch(t, crashed)
+	if err := listener.HandleMessage(ctx, matchFound); err != nil {
+		t.Fatalf("HandleMessage: %v", err)
+	}
+	crashed.Close()
+
+	// The orchestrator's handler reports the events it handled, so the test can wait for the redelivery.
+	redelivered := make(chan struct{}, 1)
+	handleMatch := func(ctx context.Context, msg kafka.Message) error {
+		err := listener.HandleMessage(ctx, msg)
+		redelivered <- struct{}{}
+		return err
+	}
+
+	config := kafkautil.RunnerConfig{MaxAttempts: 3, MinBackoff: 10 * time.Millisecond, Concurrency: 2, DrainTimeout: time.Second}
+	orchestrationConfig, gatewayConfig := config, config
+	orchestrationConfig.Name, gatewayConfig.Name = "test.orchestration", "test.api-gateway"
+	gateway := apigateway.NewMatchmakingConsumer(codec, events.NewMemoryProcessedStore(), cm)
+	runners := []*kafkautil.Runner{
+		kafkautil.NewRunner(bus.Subscribe(matchFoundTopic, "orchestrator_group"), bus, handleMatch, orchestrationConfig),
+		kafkautil.NewRunner(bus.Subscribe(matchFoundTopic, "api-gateway"), bus, gateway.HandleMessage, gatewayConfig),
+	}
+	var wg sync.WaitGroup
+	for _, runner := range runners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runner.Run(ctx)
+		}()
+	}
+	defer wg.Wait()
+	defer cancel()
+
+	event := &nexusclashv1.MatchFoundEvent{}
+	if _, err := codec.Decode(matchFound.Value, event); err != nil {
+		t.Fatalf("Decode match_found: %v", err)
+	}
+	if got := events.UUIDValues(event.GetPlayerIds()); strings.Join(got, ",") != strings.Join(players, ",") {
+		t.Fatalf("match_found players = %v, want %v", got, players)
+	}
+
+	// Both players are notified once, by the gateway's own consumer group.
+	for i, client := range clients {
+		var notification map[string]interface{}
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := client.ReadJSON(&notification); err != nil {
+			t.Fatalf("player %d: ReadJSON: %v", i, err)
+		}
+		if notification["type"] != "MATCH_FOUND" || notification["matchID"] != event.GetMatchId() {
+			t.Fatalf("player %d got %v, want MATCH_FOUND for %s", i, notification, event.GetMatchId())
+		}
+	}
+
+	ready := &nexusclashv1.GameServerReadyEvent{}
+	if _, err := codec.Decode(fetch(t, serverReady).Value, ready); err != nil {
+		t.Fatalf("Decode game_server_ready: %v", err)
+	}
+	if ready.GetMatchId() != event.GetMatchId() {
+		t.Fatalf("game_server_ready for match %s, want %s", ready.GetMatchId(), event.GetMatchId())
+	}
+
+	// The redelivered event reaches the second orchestrator instance, which drops it as a duplicate.
+	select {
+	case <-redelivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("match_found event was not redelivered to the orchestrator group")
+	}
+
+	// No second server was provisioned, no player got a second notification and nothing was dead-lettered.
+	noneCtx, noneCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer noneCancel()
+	if msg, err := serverReady.FetchMessage(noneCtx); err == nil {
+		t.Fatalf("unexpected second game_server_ready event %q", msg.Value)
+	}
+	for i, client := range clients {
+		client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		var notification map[string]interface{}
+		if err := client.ReadJSON(&notification); err == nil {
+			t.Fatalf("player %d got a second notification %v", i, notification)
+		}
+	}
+	dlq := bus.Subscribe(kafkautil.DeadLetterTopic(matchFoundTopic), "test")
+	dlqCtx, dlqCancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer dlqCancel()
+	if msg, err := dlq.FetchMessage(dlqCtx); err == nil {
+		t.Fatalf("unexpected dead letter %q", msg.Value)
+	}
+}
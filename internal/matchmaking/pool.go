@@ -2,28 +2,42 @@ package matchmaking
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	kafkautil "github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/outbox"
 )
 
-// Pool represents the matchmaking pool stored in Redis.
+// Pool represents the matchmaking pool. NewPool stores it in Redis, NewMemoryPool in memory.
 type Pool interface {
 	AddPlayer(ctx context.Context, playerID string) error
 	RemovePlayer(ctx context.Context, playerID string) error
-	FindMatch(ctx context.Context, requiredPlayers int) ([]string, error)
+	FindMatch(ctx context.Context, requiredPlayers int, announce AnnounceFunc) ([]string, error)
 }
 
+// AnnounceFunc publishes the events of a match to the publisher of the pool, which records them
+// together with taking the players from the pool. The players are only removed if it succeeds.
+type AnnounceFunc func(events kafkautil.Publisher, playerIDs []string) error
+
 type redisPool struct {
 	rdb     *redis.Client
 	poolKey string
+	outbox  *outbox.RedisStore // Match events are relayed to Kafka from here.
 }
 
-func NewPool(rdb *redis.Client, poolKey string) Pool {
+// NewPool creates a pool in Redis. Its match events are stored in the outbox, which must live in
+// the same Redis, in the transaction that takes the players. A pool that only adds and removes
+// players needs no outbox.
+func NewPool(rdb *redis.Client, poolKey string, eventOutbox *outbox.RedisStore) Pool {
 	return &redisPool{
 		rdb:     rdb,
 		poolKey: poolKey,
+		outbox:  eventOutbox,
 	}
 }
 
@@ -50,41 +64,116 @@ func (p *redisPool) RemovePlayer(ctx context.Context, playerID string) error {
 	return err
 }
 
-// FindMatch attempts to find enough players to form a match.
-func (p *redisPool) FindMatch(ctx context.Context, requiredPlayers int) ([]string, error) {
-	// ZCard gets the total number of players in the pool.
-	count, err := p.rdb.ZCard(ctx, p.poolKey).Result()
+// FindMatch attempts to find enough players to form a match. The players are removed from the pool
+// in the same transaction (MULTI/EXEC) that stores the events published by announce in the outbox,
+// so a match can neither lose its players nor be announced without taking them. If the pool changes
+// concurrently, no match is returned and the players are picked up by the next attempt.
+func (p *redisPool) FindMatch(ctx context.Context, requiredPlayers int, announce AnnounceFunc) ([]string, error) {
+	var matched []string
+	// WATCH makes the transaction fail if another instance takes players from the pool in the meantime.
+	err := p.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		// ZCard gets the total number of players in the pool.
+		count, err := tx.ZCard(ctx, p.poolKey).Result()
+		if err != nil {
+			return err
+		}
+
+		// If we don't have enough players, there's no match.
+		if count < int64(requiredPlayers) {
+			return nil // Not an error, just no match found yet.
+		}
+
+		// ZRange gets a range of members from the sorted set. We get the first `requiredPlayers` members,
+		// which are the ones who have been waiting the longest (lowest score/timestamp).
+		playerIDs, err := tx.ZRange(ctx, p.poolKey, 0, int64(requiredPlayers-1)).Result()
+		if err != nil {
+			return err
+		}
+
+		// Once we've identified the players for a match, we must remove them from the pool
+		// to prevent them from being matched into another game simultaneously.
+		// ZRem is variadic, so we convert our slice of strings to a slice of interface{}.
+		members := make([]interface{}, len(playerIDs))
+		for i, v := range playerIDs {
+			members[i] = v
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZRem(ctx, p.poolKey, members...)
+			return announce(p.outbox.InTx(pipe), playerIDs)
+		})
+		if err != nil {
+			return err
+		}
+
+		matched = playerIDs
+		return nil
+	}, p.poolKey)
 	if err != nil {
+		if errors.Is(err, redis.TxFailedErr) {
+			slog.Info("Matchmaking pool changed while forming a match, retrying later", "pool", p.poolKey)
+			return nil, nil
+		}
+		slog.Error("Failed to take matched players from pool", "pool", p.poolKey, "error", err)
 		return nil, err
 	}
 
-	// If we don't have enough players, there's no match.
-	if count < int64(requiredPlayers) {
-		return nil, nil // Not an error, just no match found yet.
+	if matched != nil {
+		slog.Info("Match found!", "player_count", len(matched), "players", matched)
 	}
+	return matched, nil
+}
 
-	// ZRange gets a range of members from the sorted set. We get the first `requiredPlayers` members,
-	// which are the ones who have been waiting the longest (lowest score/timestamp).
-	playerIDs, err := p.rdb.ZRange(ctx, p.poolKey, 0, int64(requiredPlayers-1)).Result()
-	if err != nil {
-		return nil, err
+// memoryPool keeps the players of a pool in memory, in the order they joined.
+type memoryPool struct {
+	events kafkautil.Publisher
+
+	mu      sync.Mutex
+	players []string
+}
+
+// NewMemoryPool creates a pool in memory, for tests and for running matchmaking without Redis.
+// Its match events are published directly, while the players are taken from the pool.
+func NewMemoryPool(events kafkautil.Publisher) Pool {
+	return &memoryPool{events: events}
+}
+
+func (p *memoryPool) AddPlayer(ctx context.Context, playerID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, id := range p.players {
+		if id == playerID {
+			return nil
+		}
 	}
+	p.players = append(p.players, playerID)
+	return nil
+}
 
-	// Important: Once we've identified the players for a match, we must remove them from the pool
-	// to prevent them from being matched into another game simultaneously.
-	// ZRem is variadic, so we can remove multiple members at once.
-	// We convert our slice of strings to a slice of interface{} for the ZRem function.
-	members := make([]interface{}, len(playerIDs))
-	for i, v := range playerIDs {
-		members[i] = v
+func (p *memoryPool) RemovePlayer(ctx context.Context, playerID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, id := range p.players {
+		if id == playerID {
+			p.players = append(p.players[:i], p.players[i+1:]...)
+			break
+		}
 	}
-	if _, err := p.rdb.ZRem(ctx, p.poolKey, members...).Result(); err != nil {
-		// If this fails, we should ideally add the players back to not lose them.
-		// For now, we'll log the error.
-		slog.Error("CRITICAL: Failed to remove matched players from pool", "error", err)
-		return nil, err
+	return nil
+}
+
+// FindMatch takes the players who have waited the longest. The lock is held while the match is
+// announced, so the players stay in the pool if the events cannot be published.
+func (p *memoryPool) FindMatch(ctx context.Context, requiredPlayers int, announce AnnounceFunc) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.players) < requiredPlayers {
+		return nil, nil
 	}
 
-	slog.Info("Match found!", "player_count", len(playerIDs), "players", playerIDs)
-	return playerIDs, nil
+	matched := append([]string(nil), p.players[:requiredPlayers]...)
+	if err := announce(p.events, matched); err != nil {
+		return nil, err
+	}
+	p.players = p.players[requiredPlayers:]
+	return matched, nil
 }
@@ -2,33 +2,33 @@ package matchmaking
 
 import (
 	"context"
-	"encoding/json"
 	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
-)
 
-// MatchFoundEvent is the payload we will send to Kafka.
-type MatchFoundEvent struct {
-	MatchID   string   `json:"matchID"`
-	PlayerIDs []string `json:"playerIDs"`
-}
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/events"
+	kafkautil "github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
+)
 
 // Service orchestrates the matchmaking process.
 type Service struct {
 	pool            Pool
 	checkInterval   time.Duration
 	playersPerMatch int
-	producer        *kafka.Writer // Added Kafka producer
+	codec           *events.Codec
+	matchFoundTopic string
 }
 
-// NewService creates a new matchmaking service.
-func NewService(pool Pool, producer *kafka.Writer, checkInterval time.Duration, playersPerMatch int) *Service {
+// NewService creates a new matchmaking service. Match events are published through the pool, see AnnounceFunc.
+func NewService(pool Pool, codec *events.Codec, matchFoundTopic string, checkInterval time.Duration, playersPerMatch int) *Service {
 	return &Service{
 		pool:            pool,
-		producer:        producer,
+		codec:           codec,
+		matchFoundTopic: matchFoundTopic,
 		checkInterval:   checkInterval,
 		playersPerMatch: playersPerMatch,
 	}
@@ -39,9 +39,10 @@ func NewService(pool Pool, producer *kafka.Writer, checkInterval time.Duration,
 func (s *Service) Start(ctx context.Context) {
 	slog.Info("Matchmaking service loop started", "interval", s.checkInterval)
 	ticker := time.NewTicker(s.checkInterval)
-	defer ticker.Stop()
 
 	go func() {
+		// The ticker is stopped by the loop, not by Start, which returns right away.
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ctx.Done():
@@ -55,46 +56,35 @@ func (s *Service) Start(ctx context.Context) {
 }
 
 func (s *Service) findAndProcessMatches(ctx context.Context) {
-	players, err := s.pool.FindMatch(ctx, s.playersPerMatch)
-	if err != nil {
-		slog.Error("Error finding match", "error", err)
-		return
-	}
-
-	if players == nil {
-		return
-	}
-
-	slog.Info("Processing found match", "players", players)
-
-	// 1. Generate a unique Match ID.
+	// The match ID is generated up front, so the event can be queued in the transaction that takes the players.
 	matchID := uuid.New().String()
 
-	// 2. Create the event payload.
-	event := MatchFoundEvent{
-		MatchID:   matchID,
-		PlayerIDs: players,
+	// The event is recorded together with the removal of the players from the pool. With the Redis
+	// pool, it goes to the outbox, whose relay retries a failed publish instead of losing the match.
+	announce := func(publisher kafkautil.Publisher, players []string) error {
+		eventBytes, err := s.codec.Encode(ctx, &nexusclashv1.MatchFoundEvent{
+			MatchId:   matchID,
+			PlayerIds: events.UUIDs(players),
+		})
+		if err != nil {
+			return err
+		}
+		return publisher.Publish(ctx, kafka.Message{
+			Topic: s.matchFoundTopic,
+			Key:   []byte(matchID), // Use matchID as the key for partitioning.
+			Value: eventBytes,
+		})
 	}
 
-	// 3. Marshal the event to JSON.
-	eventBytes, err := json.Marshal(event)
+	players, err := s.pool.FindMatch(ctx, s.playersPerMatch, announce)
 	if err != nil {
-		slog.Error("Failed to marshal MatchFoundEvent", "error", err)
-		// Ideally, we'd add the players back to the pool here.
+		slog.Error("Error finding match", "error", err)
 		return
 	}
 
-	// 4. Publish the event to Kafka.
-	err = s.producer.WriteMessages(ctx, kafka.Message{
-		Key:   []byte(matchID), // Use matchID as the key for partitioning.
-		Value: eventBytes,
-	})
-	if err != nil {
-		slog.Error("Failed to write message to Kafka", "error", err)
-		// Critical error: handle this with retries or an alert system.
-	} else {
-		slog.Info("MatchFoundEvent published to Kafka", "matchID", matchID)
+	if players == nil {
+		return
 	}
 
-	// The TODO is now complete! This service's job is done for this match.
+	slog.Info("match_found event queued for publishing", "matchID", matchID, "players", players)
 }
@@ -7,6 +7,9 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
+	"github.com/cheildo/nexus-clash-backend/internal/auth"
 )
 
 // upgrader is used to upgrade an HTTP connection to a persistent WebSocket connection.
@@ -19,10 +22,17 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
+// Queue modes a player can pick with the "mode" query parameter. Each mode has its own pool.
+const (
+	ModeCasual = "casual"
+	ModeRanked = "ranked"
+)
+
 // Add a connection manager to the handler struct.
 type WebsocketHandler struct {
-	pool Pool
-	cm   ConnectionManager // Use an interface for better testing
+	pools      map[string]Pool   // Pools keyed by queue mode.
+	cm         ConnectionManager // Use an interface for better testing
+	authClient nexusclashv1.AuthServiceClient
 }
 
 // ConnectionManager defines the interface we need to manage connections.
@@ -31,21 +41,62 @@ type ConnectionManager interface {
 	Remove(playerID string)
 }
 
-func NewWebsocketHandler(pool Pool, cm ConnectionManager) *WebsocketHandler {
+func NewWebsocketHandler(pools map[string]Pool, cm ConnectionManager, authClient nexusclashv1.AuthServiceClient) *WebsocketHandler {
 	return &WebsocketHandler{
-		pool: pool,
-		cm:   cm,
+		pools:      pools,
+		cm:         cm,
+		authClient: authClient,
 	}
 }
 
-// ... (ServeHTTP method) ...
+// ServeHTTP upgrades the request to a WebSocket and queues the player for matchmaking.
+// It must be mounted behind auth.Middleware, which supplies the authenticated player ID.
 func (h *WebsocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// ... (playerID extraction and connection upgrade are the same) ...
-	playerID := r.URL.Query().Get("playerID")
-	if playerID == "" {
-		http.Error(w, "Player ID is required", http.StatusBadRequest)
+	// The player ID comes from the validated token, never from client-supplied parameters,
+	// so a client cannot queue on behalf of another player.
+	playerID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
 		return
 	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = ModeCasual
+	}
+	pool, ok := h.pools[mode]
+	if !ok {
+		http.Error(w, "Unknown matchmaking mode", http.StatusBadRequest)
+		return
+	}
+	// Ranked play requires a verified email, which makes it costlier to evade bans or
+	// boost ratings with throwaway accounts.
+	if mode == ModeRanked {
+		claims, _ := auth.ClaimsFromContext(r.Context())
+		if !claims.GetEmailVerified() {
+			http.Error(w, "A verified email address is required for ranked matchmaking", http.StatusForbidden)
+			return
+		}
+	}
+
+	// Token validation already rejects sanctioned players, but a queue connection can last long after
+	// the token was checked, so admission asks the auth service for the player's current standing.
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	resp, err := h.authClient.GetActiveSanction(ctx, &nexusclashv1.GetActiveSanctionRequest{
+		UserId: &nexusclashv1.UUID{Value: playerID},
+	})
+	cancel()
+	if err != nil {
+		slog.Error("Failed to check account sanctions", "playerID", playerID, "error", err)
+		http.Error(w, "Matchmaking is temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if resp.GetSanction() != nil {
+		slog.Warn("Rejected sanctioned player from matchmaking", "playerID", playerID, "type", resp.GetSanction().GetType())
+		http.Error(w, "Your account is banned or suspended", http.StatusForbidden)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		slog.Error("Failed to upgrade connection to WebSocket", "error", err)
@@ -55,24 +106,24 @@ func (h *WebsocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Add the connection to our manager.
 	h.cm.Add(playerID, conn)
 
-	if err := h.pool.AddPlayer(r.Context(), playerID); err != nil {
+	if err := pool.AddPlayer(r.Context(), playerID); err != nil {
 		slog.Error("Failed to add player to pool", "playerID", playerID, "error", err)
 		h.cm.Remove(playerID) // Clean up if adding to pool fails
 		conn.Close()
 		return
 	}
 
-	h.handleConnection(conn, playerID)
+	h.handleConnection(conn, pool, playerID)
 }
 
 // handleConnection manages a single WebSocket connection.
-func (h *WebsocketHandler) handleConnection(conn *websocket.Conn, playerID string) {
+func (h *WebsocketHandler) handleConnection(conn *websocket.Conn, pool Pool, playerID string) {
 	// The defer statement is crucial. It ensures that when the connection is closed for any reason
 	// (client disconnects, error, etc.), we clean up by removing the player from the pool.
 	defer func() {
 		slog.Info("Closing WebSocket connection and cleaning up", "playerID", playerID)
 		h.cm.Remove(playerID) // Remove from connection manager
-		h.pool.RemovePlayer(context.Background(), playerID)
+		pool.RemovePlayer(context.Background(), playerID)
 		conn.Close()
 	}()
 
@@ -2,97 +2,163 @@ package orchestration
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"sync/atomic"
 	"time"
 
 	"github.com/segmentio/kafka-go"
+
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/events"
+	kafkautil "github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
 )
 
 // Listener is the main component that listens to Kafka and orchestrates games.
 type Listener struct {
-	consumer       *kafka.Reader
-	producer       *kafka.Writer
-	runningServers *atomic.Int64 // Safely count running servers
+	events           kafkautil.Publisher // Server events, usually the outbox that relays them to Kafka.
+	processed        events.LeasedDeduplicator
+	codec            *events.Codec
+	serverReadyTopic string
+	provisionDelay   time.Duration // Simulated time it takes to start a server.
+	provisionTimeout time.Duration // Upper bound of provisioning, which also bounds the claim of a match.
+	runningServers   *atomic.Int64 // Safely count running servers
 }
 
-func NewListener(consumer *kafka.Reader, producer *kafka.Writer) *Listener {
+// claimMargin is added to the provision timeout for the lease of a match, so the claim outlives
+// provisioning long enough to record its result.
+const claimMargin = 5 * time.Second
+
+// claimPollInterval is how often a match claimed by another instance is checked again.
+const claimPollInterval = time.Second
+
+func NewListener(serverEvents kafkautil.Publisher, processed events.LeasedDeduplicator, codec *events.Codec, serverReadyTopic string, provisionDelay, provisionTimeout time.Duration) *Listener {
 	return &Listener{
-		consumer:       consumer,
-		producer:       producer,
-		runningServers: &atomic.Int64{},
+		events:           serverEvents,
+		processed:        processed,
+		codec:            codec,
+		serverReadyTopic: serverReadyTopic,
+		provisionDelay:   provisionDelay,
+		provisionTimeout: provisionTimeout,
+		runningServers:   &atomic.Int64{},
 	}
 }
 
-// Run starts the Kafka consumer loop. It should be run in a goroutine.
-func (l *Listener) Run(ctx context.Context) {
-	slog.Info("Orchestration listener started")
-	defer l.consumer.Close()
-	defer l.producer.Close()
+// HandleMessage provisions a game server for a match_found event. It is run by a kafka.Runner.
+func (l *Listener) HandleMessage(ctx context.Context, msg kafka.Message) error {
+	event := &nexusclashv1.MatchFoundEvent{}
+	envelope, err := l.codec.Decode(msg.Value, event)
+	if err != nil {
+		return kafkautil.Permanent(err)
+	}
+
+	// Kafka may deliver the event again, and the matchmaking relay may publish it twice. Matches are
+	// deduplicated by ID rather than by event ID, so a match never gets a second server. The match is
+	// only claimed while it is provisioned, and recorded as processed once its server is ready: if
+	// this instance dies in between, the claim expires and the redelivered event is provisioned.
+	key := "match:" + event.GetMatchId()
+	claimed, err := l.claimMatch(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		slog.Info("Dropping duplicate match_found event", "matchID", event.GetMatchId(), "eventID", envelope.GetEventId())
+		return nil
+	}
+
+	// The event is only committed once the server is provisioned; the runner handles several
+	// matches at a time. The game_server_ready event continues the trace of the match.
+	provisionCtx, cancel := context.WithTimeout(events.ContextWithTrace(ctx, envelope.GetTraceContext()), l.provisionTimeout)
+	defer cancel()
+	if err := l.provisionGameServer(provisionCtx, event); err != nil {
+		// The match is released, so that the retry of the event can provision it. A real provisioner
+		// would name servers by match ID, so a server that was started anyway is found, not duplicated.
+		if forgetErr := l.processed.Forget(context.WithoutCancel(ctx), key); forgetErr != nil {
+			slog.Error("Failed to release match after failed provisioning", "matchID", event.GetMatchId(), "error", forgetErr)
+		}
+		return err
+	}
+
+	// The server is ready, so the event is committed even if this fails. Only a second publication
+	// of the match after the claim expired could then provision it again.
+	if err := l.processed.Complete(context.WithoutCancel(ctx), key); err != nil {
+		slog.Error("Failed to record provisioned match", "matchID", event.GetMatchId(), "error", err)
+	}
+	return nil
+}
 
+// claimMatch claims a match for provisioning. It reports false if the match was provisioned
+// already. While another instance holds the claim, it waits until that instance has finished or
+// its claim has expired.
+func (l *Listener) claimMatch(ctx context.Context, key string) (bool, error) {
 	for {
-		msg, err := l.consumer.ReadMessage(ctx)
+		result, err := l.processed.Claim(ctx, key, l.provisionTimeout+claimMargin)
 		if err != nil {
-			if ctx.Err() != nil {
-				break // Context cancelled, graceful shutdown.
-			}
-			slog.Error("Error reading from Kafka", "error", err)
-			continue
+			return false, err
 		}
-
-		var event MatchFoundEvent
-		if err := json.Unmarshal(msg.Value, &event); err != nil {
-			slog.Error("Failed to unmarshal match_found event", "error", err)
-			continue
+		switch result {
+		case events.ClaimAcquired:
+			return true, nil
+		case events.ClaimProcessed:
+			return false, nil
 		}
 
-		go l.provisionGameServer(ctx, event)
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(claimPollInterval):
+		}
 	}
-	slog.Info("Orchestration listener stopped.")
 }
 
 // provisionGameServer simulates the process of starting a new server.
-func (l *Listener) provisionGameServer(ctx context.Context, event MatchFoundEvent) {
-	slog.Info("Provisioning new game server...", "matchID", event.MatchID)
+func (l *Listener) provisionGameServer(ctx context.Context, event *nexusclashv1.MatchFoundEvent) error {
+	slog.Info("Provisioning new game server...", "matchID", event.GetMatchId())
 	l.runningServers.Add(1)
 	defer l.runningServers.Add(-1)
 
 	// --- SIMULATION ---
 	// In a real system, this is where you'd call the Docker SDK or Kubernetes API.
 	// This process could take several seconds. We simulate a delay.
-	time.Sleep(2 * time.Second)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(l.provisionDelay):
+	}
 
 	gameServerAddr := "localhost"
 	gameServerPort := "7777" // Placeholder port
 
-	slog.Info("Game server provisioned successfully", "matchID", event.MatchID, "address", fmt.Sprintf("%s:%s", gameServerAddr, gameServerPort))
+	slog.Info("Game server provisioned successfully", "matchID", event.GetMatchId(), "address", fmt.Sprintf("%s:%s", gameServerAddr, gameServerPort))
 
 	// --- PUBLISH RESULT ---
-	readyEvent := GameServerReadyEvent{
-		MatchID:    event.MatchID,
-		PlayerIDs:  event.PlayerIDs,
+	readyEvent := &nexusclashv1.GameServerReadyEvent{
+		MatchId:    event.GetMatchId(),
+		PlayerIds:  event.GetPlayerIds(),
 		ServerAddr: gameServerAddr,
 		ServerPort: gameServerPort,
 	}
 
-	eventBytes, err := json.Marshal(readyEvent)
+	eventBytes, err := l.codec.Encode(ctx, readyEvent)
 	if err != nil {
-		slog.Error("Failed to marshal game_server_ready event", "error", err)
-		return
+		slog.Error("Failed to encode game_server_ready event", "error", err)
+		return err
 	}
 
-	err = l.producer.WriteMessages(ctx, kafka.Message{
-		Key:   []byte(event.MatchID),
+	// In production the event goes through the outbox, whose relay retries until Kafka has it, so
+	// the players are not left waiting for a server that is already running.
+	err = l.events.Publish(ctx, kafka.Message{
+		Topic: l.serverReadyTopic,
+		Key:   []byte(event.GetMatchId()),
 		Value: eventBytes,
 	})
-
 	if err != nil {
-		slog.Error("Failed to publish game_server_ready event", "error", err)
-	} else {
-		slog.Info("Published game_server_ready event", "matchID", event.MatchID)
+		slog.Error("Failed to queue game_server_ready event", "matchID", event.GetMatchId(), "error", err)
+		return err
 	}
+	slog.Info("Queued game_server_ready event for publishing", "matchID", event.GetMatchId())
+	return nil
 }
 
 // GetRunningServers provides a thread-safe way to check the count.
@@ -0,0 +1,61 @@
+package orchestration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/events"
+	kafkautil "github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
+)
+
+// TestListenerProvisionsMatchAfterClaimExpires covers an instance that died while provisioning:
+// its claim of the match is left behind, and the redelivered event must still get a server.
+func TestListenerProvisionsMatchAfterClaimExpires(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bus := kafkautil.NewMemoryBus(1)
+	serverReady := bus.Subscribe("game_server_ready_events", "test")
+	codec := events.NewCodec(events.FormatJSON)
+	processed := events.NewMemoryProcessedStore()
+	listener := NewListener(bus, processed, codec, "game_server_ready_events", 0, time.Second)
+
+	matchID := uuid.NewString()
+	value, err := codec.Encode(ctx, &nexusclashv1.MatchFoundEvent{MatchId: matchID, PlayerIds: events.UUIDs([]string{uuid.NewString()})})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	msg := kafka.Message{Topic: "match_found_events", Key: []byte(matchID), Value: value}
+
+	// The claim of the dead instance, which is never completed.
+	if _, err := processed.Claim(ctx, "match:"+matchID, 100*time.Millisecond); err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+
+	if err := listener.HandleMessage(ctx, msg); err != nil {
+		t.Fatalf("HandleMessage: %v", err)
+	}
+	ready, err := serverReady.FetchMessage(ctx)
+	if err != nil {
+		t.Fatalf("no game_server_ready event: %v", err)
+	}
+	if string(ready.Key) != matchID {
+		t.Fatalf("game_server_ready for %s, want %s", ready.Key, matchID)
+	}
+
+	// Once provisioned, the match is dropped when its event is delivered again.
+	if err := listener.HandleMessage(ctx, msg); err != nil {
+		t.Fatalf("HandleMessage of duplicate: %v", err)
+	}
+	noneCtx, noneCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer noneCancel()
+	if dup, err := serverReady.FetchMessage(noneCtx); err == nil {
+		t.Fatalf("unexpected second game_server_ready event %q", dup.Value)
+	}
+}
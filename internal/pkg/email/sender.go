@@ -0,0 +1,121 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers emails. Implementations are selected by configuration, so local development
+// can use the log or file stand-ins instead of a real mail server.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config holds the configuration for creating a Sender.
+type Config struct {
+	Provider string // "log", "file" or "smtp"
+	From     string
+	FileDir  string // Used by the file provider.
+	SMTP     SMTPConfig
+}
+
+// SMTPConfig holds the settings of the SMTP provider.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+// NewSender creates the Sender selected by cfg.Provider.
+func NewSender(cfg Config) (Sender, error) {
+	switch cfg.Provider {
+	case "", "log":
+		return &logSender{}, nil
+	case "file":
+		if err := os.MkdirAll(cfg.FileDir, 0o755); err != nil {
+			return nil, fmt.Errorf("creating email directory: %w", err)
+		}
+		return &fileSender{dir: cfg.FileDir, from: cfg.From}, nil
+	case "smtp":
+		return &smtpSender{cfg: cfg.SMTP, from: cfg.From}, nil
+	default:
+		return nil, fmt.Errorf("unknown email provider %q", cfg.Provider)
+	}
+}
+
+// logSender writes emails to the application log. Intended for local development only.
+type logSender struct{}
+
+func (s *logSender) Send(ctx context.Context, msg Message) error {
+	slog.Info("Email (log sender)", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// fileSender writes each email as an .eml file, which most mail clients can open.
+type fileSender struct {
+	dir  string
+	from string
+}
+
+func (s *fileSender) Send(ctx context.Context, msg Message) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405Z"), uuid.New().String())
+	path := filepath.Join(s.dir, name)
+	if err := os.WriteFile(path, formatMessage(s.from, msg), 0o644); err != nil {
+		slog.Error("Failed to write email file", "path", path, "error", err)
+		return err
+	}
+	slog.Info("Email written to file", "to", msg.To, "path", path)
+	return nil
+}
+
+// smtpSender delivers emails through an SMTP server using PLAIN authentication.
+type smtpSender struct {
+	cfg  SMTPConfig
+	from string
+}
+
+func (s *smtpSender) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+	addr := fmt.Sprintf("%s:%s", s.cfg.Host, s.cfg.Port)
+	if err := smtp.SendMail(addr, auth, s.from, []string{msg.To}, formatMessage(s.from, msg)); err != nil {
+		slog.Error("Failed to send email via SMTP", "to", msg.To, "error", err)
+		return err
+	}
+	return nil
+}
+
+// headerSanitizer strips line breaks from header values, which would otherwise allow header injection.
+var headerSanitizer = strings.NewReplacer("\r", "", "\n", "")
+
+// formatMessage renders a message in RFC 5322 format.
+func formatMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerSanitizer.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerSanitizer.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerSanitizer.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
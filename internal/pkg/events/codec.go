@@ -0,0 +1,163 @@
+// Package events encodes and decodes the events the services exchange over Kafka. Every event is a
+// proto message from api/proto/nexusclash/v1/events.proto, wrapped in an EventEnvelope that carries
+// its ID, type, schema version, time and trace context.
+package events
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown event format")
+	// ErrUnknownEventType is returned when encoding a message that is not a registered event.
+	ErrUnknownEventType = errors.New("unknown event type")
+	// ErrUnexpectedEventType is returned when an envelope holds a different event than the caller expects.
+	ErrUnexpectedEventType = errors.New("unexpected event type")
+	// ErrUnsupportedVersion is returned for events with a newer schema than this build understands.
+	ErrUnsupportedVersion = errors.New("unsupported event version")
+	ErrMalformedEvent     = errors.New("malformed event")
+)
+
+// versions holds the current schema version of every event. A version is raised when an event
+// changes in a way older consumers cannot read; consumers reject versions newer than theirs.
+var versions = map[string]uint32{
+	typeOf(&nexusclashv1.MatchFoundEvent{}):        1,
+	typeOf(&nexusclashv1.GameServerReadyEvent{}):   1,
+	typeOf(&nexusclashv1.UserRegisteredEvent{}):    1,
+	typeOf(&nexusclashv1.AccountSanctionedEvent{}): 1,
+	typeOf(&nexusclashv1.AccountDeletedEvent{}):    1,
+	typeOf(&nexusclashv1.ProfileUpdatedEvent{}):    1,
+}
+
+// Format is the wire format of encoded envelopes.
+type Format int
+
+const (
+	// FormatJSON is the protobuf JSON mapping, which is easy to inspect with Kafka tooling.
+	FormatJSON Format = iota
+	// FormatBinary is the protobuf wire format, which is smaller and faster to decode.
+	FormatBinary
+)
+
+// ParseFormat parses the "event_format" setting, "json" or "binary".
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "json":
+		return FormatJSON, nil
+	case "binary":
+		return FormatBinary, nil
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnknownFormat, s)
+	}
+}
+
+func (f Format) String() string {
+	if f == FormatBinary {
+		return "binary"
+	}
+	return "json"
+}
+
+// Codec is shared by producers and consumers. The format only applies to encoding; decoding
+// detects it, so the format of a topic can be switched without draining it first.
+type Codec struct {
+	format Format
+}
+
+func NewCodec(format Format) *Codec {
+	return &Codec{format: format}
+}
+
+// Encode wraps the event in a new envelope. The trace context is taken from ctx, or a new trace is
+// started if there is none.
+func (c *Codec) Encode(ctx context.Context, event proto.Message) ([]byte, error) {
+	eventType := typeOf(event)
+	version, ok := versions[eventType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEventType, eventType)
+	}
+
+	payload, err := anypb.New(event)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := &nexusclashv1.EventEnvelope{
+		EventId:      uuid.New().String(),
+		EventType:    eventType,
+		Version:      version,
+		OccurredAt:   timestamppb.New(time.Now()),
+		TraceContext: childTrace(TraceFromContext(ctx)),
+		Payload:      payload,
+	}
+
+	if c.format == FormatBinary {
+		return proto.Marshal(envelope)
+	}
+	return protojson.Marshal(envelope)
+}
+
+// Decode unmarshals an envelope in either format into event, which must be of the type the
+// envelope holds. The envelope is returned for its metadata.
+func (c *Codec) Decode(data []byte, event proto.Message) (*nexusclashv1.EventEnvelope, error) {
+	envelope := &nexusclashv1.EventEnvelope{}
+
+	var err error
+	// A binary envelope starts with a field tag, which is never '{'.
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, envelope)
+	} else {
+		err = proto.Unmarshal(data, envelope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedEvent, err)
+	}
+
+	want := typeOf(event)
+	if envelope.GetEventType() != want {
+		return envelope, fmt.Errorf("%w: got %s, want %s", ErrUnexpectedEventType, envelope.GetEventType(), want)
+	}
+	if envelope.GetVersion() > versions[want] {
+		return envelope, fmt.Errorf("%w: %s version %d", ErrUnsupportedVersion, want, envelope.GetVersion())
+	}
+	if err := envelope.GetPayload().UnmarshalTo(event); err != nil {
+		return envelope, fmt.Errorf("%w: %v", ErrMalformedEvent, err)
+	}
+
+	return envelope, nil
+}
+
+// typeOf returns the full proto name of a message, which is the event type in envelopes.
+func typeOf(event proto.Message) string {
+	return string(event.ProtoReflect().Descriptor().FullName())
+}
+
+// UUIDs converts IDs to their proto representation.
+func UUIDs(ids []string) []*nexusclashv1.UUID {
+	out := make([]*nexusclashv1.UUID, len(ids))
+	for i, id := range ids {
+		out[i] = &nexusclashv1.UUID{Value: id}
+	}
+	return out
+}
+
+// UUIDValues converts proto UUIDs back to plain IDs.
+func UUIDValues(ids []*nexusclashv1.UUID) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.GetValue()
+	}
+	return out
+}
@@ -0,0 +1,189 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Deduplicator remembers which events a consumer has acted on. ProcessedStore implements it in
+// Redis, and MemoryProcessedStore within one process.
+type Deduplicator interface {
+	// MarkProcessed records a key and reports false if it was already recorded.
+	MarkProcessed(ctx context.Context, key string) (bool, error)
+	// Forget removes a key, so that the event is acted on when it is delivered again.
+	Forget(ctx context.Context, key string) error
+}
+
+// LeasedDeduplicator records keys in two steps, for consumers whose work takes a while and can be
+// interrupted by a crash. A key is claimed for a lease while the event is acted on, and marked as
+// processed once that succeeded. If the consumer dies in between, the claim expires with its lease
+// and the redelivered event is acted on again, instead of being dropped as a duplicate.
+type LeasedDeduplicator interface {
+	// Claim records a key for the duration of the lease, unless it is claimed or processed already.
+	Claim(ctx context.Context, key string, lease time.Duration) (ClaimResult, error)
+	// Complete marks a claimed key as processed, for as long as processed keys are kept.
+	Complete(ctx context.Context, key string) error
+	// Forget removes a claim whose work failed, so that the event is acted on when it is delivered again.
+	Forget(ctx context.Context, key string) error
+}
+
+// ClaimResult is the outcome of LeasedDeduplicator.Claim.
+type ClaimResult int
+
+const (
+	// ClaimAcquired means the caller holds the claim and must act on the event.
+	ClaimAcquired ClaimResult = iota
+	// ClaimHeld means another consumer is acting on the event, or died doing so before its lease ran out.
+	ClaimHeld
+	// ClaimProcessed means the event was acted on already and must be dropped.
+	ClaimProcessed
+)
+
+var (
+	_ Deduplicator       = (*ProcessedStore)(nil)
+	_ Deduplicator       = (*MemoryProcessedStore)(nil)
+	_ LeasedDeduplicator = (*ProcessedStore)(nil)
+	_ LeasedDeduplicator = (*MemoryProcessedStore)(nil)
+)
+
+// claimPending is the value of a claimed key. Processed keys hold the time they were recorded.
+const claimPending = "pending"
+
+// dedupeMetrics are published on the diagnostics server at /debug/vars, keyed by store name.
+var dedupeMetrics = expvar.NewMap("processed_events")
+
+// ProcessedStore remembers which events a consumer has acted on, so that events Kafka delivers
+// again are dropped instead of being acted on twice. Entries expire after the TTL, which must
+// exceed the time an event can take to be redelivered.
+type ProcessedStore struct {
+	rdb        *redis.Client
+	keyPrefix  string
+	ttl        time.Duration
+	recorded   *expvar.Int // Events seen for the first time.
+	duplicates *expvar.Int // Events dropped as already processed.
+}
+
+// NewProcessedStore creates a store under the given key prefix, e.g. "orchestration:processed".
+// The prefix also names the store in metrics.
+func NewProcessedStore(rdb *redis.Client, keyPrefix string, ttl time.Duration) *ProcessedStore {
+	s := &ProcessedStore{
+		rdb:        rdb,
+		keyPrefix:  keyPrefix,
+		ttl:        ttl,
+		recorded:   new(expvar.Int),
+		duplicates: new(expvar.Int),
+	}
+	store := new(expvar.Map).Init()
+	store.Set("recorded", s.recorded)
+	store.Set("duplicates_dropped", s.duplicates)
+	dedupeMetrics.Set(keyPrefix, store)
+	return s
+}
+
+// MarkProcessed records the key of an event, usually its event ID or the ID of the entity it
+// concerns. It reports false if the key was already recorded, in which case the caller must drop
+// the event. The key is recorded before the caller acts, so concurrent deliveries cannot both act.
+func (s *ProcessedStore) MarkProcessed(ctx context.Context, key string) (bool, error) {
+	first, err := s.rdb.SetNX(ctx, s.keyPrefix+":"+key, time.Now().Unix(), s.ttl).Result()
+	if err != nil {
+		return false, err
+	}
+	if first {
+		s.recorded.Add(1)
+	} else {
+		s.duplicates.Add(1)
+	}
+	return first, nil
+}
+
+// Claim records the key of an event for the duration of the lease, see LeasedDeduplicator.
+func (s *ProcessedStore) Claim(ctx context.Context, key string, lease time.Duration) (ClaimResult, error) {
+	claimed, err := s.rdb.SetNX(ctx, s.keyPrefix+":"+key, claimPending, lease).Result()
+	if err != nil {
+		return 0, err
+	}
+	if claimed {
+		s.recorded.Add(1)
+		return ClaimAcquired, nil
+	}
+
+	value, err := s.rdb.Get(ctx, s.keyPrefix+":"+key).Result()
+	if errors.Is(err, redis.Nil) {
+		return ClaimHeld, nil // The lease ran out in the meantime, so the next attempt acquires it.
+	}
+	if err != nil {
+		return 0, err
+	}
+	if value == claimPending {
+		return ClaimHeld, nil
+	}
+	s.duplicates.Add(1)
+	return ClaimProcessed, nil
+}
+
+// Complete replaces the claim of a key with a processed entry, which expires after the TTL.
+func (s *ProcessedStore) Complete(ctx context.Context, key string) error {
+	return s.rdb.Set(ctx, s.keyPrefix+":"+key, time.Now().Unix(), s.ttl).Err()
+}
+
+// Forget removes the key of an event whose handling failed after MarkProcessed or Claim, so that
+// its redelivery is acted on.
+func (s *ProcessedStore) Forget(ctx context.Context, key string) error {
+	return s.rdb.Del(ctx, s.keyPrefix+":"+key).Err()
+}
+
+// MemoryProcessedStore is a Deduplicator and LeasedDeduplicator that keeps its keys in memory, for
+// tests and for running consumers without Redis. Processed keys do not expire and are lost when the
+// process stops.
+type MemoryProcessedStore struct {
+	mu   sync.Mutex
+	keys map[string]time.Time // Expiry of the claim of each key; zero once the key is processed.
+}
+
+func NewMemoryProcessedStore() *MemoryProcessedStore {
+	return &MemoryProcessedStore{keys: make(map[string]time.Time)}
+}
+
+func (s *MemoryProcessedStore) MarkProcessed(ctx context.Context, key string) (bool, error) {
+	result, err := s.claim(key, time.Time{})
+	return result == ClaimAcquired, err
+}
+
+func (s *MemoryProcessedStore) Claim(ctx context.Context, key string, lease time.Duration) (ClaimResult, error) {
+	return s.claim(key, time.Now().Add(lease))
+}
+
+// claim records the key with the expiry of its claim, or as processed if the expiry is zero.
+func (s *MemoryProcessedStore) claim(key string, expires time.Time) (ClaimResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, ok := s.keys[key]; ok {
+		if current.IsZero() {
+			return ClaimProcessed, nil
+		}
+		if time.Now().Before(current) {
+			return ClaimHeld, nil
+		}
+	}
+	s.keys[key] = expires
+	return ClaimAcquired, nil
+}
+
+func (s *MemoryProcessedStore) Complete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key] = time.Time{}
+	return nil
+}
+
+func (s *MemoryProcessedStore) Forget(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, key)
+	return nil
+}
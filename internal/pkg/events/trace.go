@@ -0,0 +1,62 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
+)
+
+type traceContextKey struct{}
+
+// ContextWithTrace returns a context carrying the trace of a received event, so that the events
+// published while handling it continue the same trace.
+func ContextWithTrace(ctx context.Context, trace *nexusclashv1.TraceContext) context.Context {
+	if trace.GetTraceparent() == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceContextKey{}, trace)
+}
+
+// TraceFromContext returns the trace stored by ContextWithTrace, or nil.
+func TraceFromContext(ctx context.Context) *nexusclashv1.TraceContext {
+	trace, _ := ctx.Value(traceContextKey{}).(*nexusclashv1.TraceContext)
+	return trace
+}
+
+// TraceID returns the trace ID of a W3C traceparent ("00-<trace-id>-<parent-id>-<flags>"), for logging.
+func TraceID(trace *nexusclashv1.TraceContext) string {
+	parts := strings.Split(trace.GetTraceparent(), "-")
+	if len(parts) != 4 {
+		return ""
+	}
+	return parts[1]
+}
+
+// childTrace returns the trace context of a new event caused by parent: the trace ID is kept and
+// a new parent ID is assigned. Without a valid parent, a new sampled trace is started.
+func childTrace(parent *nexusclashv1.TraceContext) *nexusclashv1.TraceContext {
+	traceID, flags := TraceID(parent), "01"
+	if len(traceID) != 32 {
+		traceID = randomHex(16)
+	} else if parts := strings.Split(parent.GetTraceparent(), "-"); len(parts[3]) == 2 {
+		flags = parts[3]
+	}
+
+	trace := &nexusclashv1.TraceContext{
+		Traceparent: "00-" + traceID + "-" + randomHex(8) + "-" + flags,
+	}
+	if parent != nil && TraceID(parent) == traceID {
+		trace.Tracestate = parent.GetTracestate()
+	}
+	return trace
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	// crypto/rand.Read does not fail on supported platforms.
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
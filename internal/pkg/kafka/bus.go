@@ -0,0 +1,29 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Publisher delivers messages to their topics. Publish returns once the messages are delivered,
+// so a nil error means they will reach the subscribers. Producer and MemoryBus implement it.
+type Publisher interface {
+	Publish(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// Subscriber reads the messages of a topic as a member of a consumer group. Messages that are
+// fetched but not committed are delivered again, to this or another member of the group.
+// A *kafka.Reader with a group ID, see NewConsumer, and the subscribers of a MemoryBus implement it.
+type Subscriber interface {
+	// FetchMessage blocks until a message is available or the context is cancelled.
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	// CommitMessages marks the messages, and the messages before them in their partitions, as consumed.
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+var (
+	_ Publisher  = (*Producer)(nil)
+	_ Subscriber = (*kafka.Reader)(nil)
+)
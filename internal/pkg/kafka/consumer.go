@@ -1,19 +1,44 @@
 package kafka
 
 import (
-	"time"
+	"os"
 
+	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
 )
 
-// NewConsumer initializes and returns a new Kafka reader (consumer).
+// NewConsumer initializes and returns a new Kafka reader (consumer). Offsets are not committed
+// when messages are read, only when they are passed to CommitMessages, which then blocks until
+// the commit is done. Use it with a Runner, which commits messages once they have been handled.
 func NewConsumer(brokers []string, topic, groupID string) *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  brokers,
+		Topic:    topic,
+		GroupID:  groupID, // Consumers in the same group share the load.
+		MinBytes: 10e3,    // 10KB
+		MaxBytes: 10e6,    // 10MB
+		// A CommitInterval of zero commits synchronously, so a commit that returns has been stored.
+		CommitInterval: 0,
+	})
+}
+
+// NewBroadcastConsumer creates a reader in a consumer group of its own, named after the prefix,
+// the host and a random suffix, so that every instance of a service receives every message of
+// the topic. The group starts with the messages published after it is created, which suits
+// events about state each instance holds in memory, like open connections. Kafka removes the
+// group once its offsets expire after the instance stopped.
+func NewBroadcastConsumer(brokers []string, topic, groupPrefix string) *kafka.Reader {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
 	return kafka.NewReader(kafka.ReaderConfig{
 		Brokers:        brokers,
 		Topic:          topic,
-		GroupID:        groupID, // Consumers in the same group share the load.
-		MinBytes:       10e3,    // 10KB
-		MaxBytes:       10e6,    // 10MB
-		CommitInterval: time.Second,
+		GroupID:        groupPrefix + "." + host + "." + uuid.NewString()[:8],
+		StartOffset:    kafka.LastOffset,
+		MinBytes:       1,    // Events are rare and urgent, so they are not batched.
+		MaxBytes:       10e6, // 10MB
+		CommitInterval: 0,
 	})
 }
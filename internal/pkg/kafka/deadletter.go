@@ -0,0 +1,82 @@
+package kafka
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DeadLetterSuffix is appended to a topic to name its dead-letter topic.
+const DeadLetterSuffix = ".dlq"
+
+// Headers added to dead-lettered messages, describing where they came from and why they failed.
+// The original headers of the message are kept.
+const (
+	HeaderOriginalTopic     = "dlq-original-topic"
+	HeaderOriginalPartition = "dlq-original-partition"
+	HeaderOriginalOffset    = "dlq-original-offset"
+	HeaderConsumer          = "dlq-consumer"
+	HeaderError             = "dlq-error"
+	HeaderAttempts          = "dlq-attempts"
+	HeaderFailedAt          = "dlq-failed-at"
+)
+
+// DeadLetterTopic returns the dead-letter topic of a topic, e.g. "match_found_events.dlq".
+func DeadLetterTopic(topic string) string {
+	return topic + DeadLetterSuffix
+}
+
+// NewDeadLetterProducer creates a producer for dead-letter topics. Unlike other topics, they are
+// created on first use, since most of them never receive a message.
+func NewDeadLetterProducer(config ProducerConfig) (*Producer, error) {
+	config.AllowAutoTopicCreation = true
+	return NewProducer(config)
+}
+
+// deadLetter builds the dead-letter message of a message that could not be processed.
+func deadLetter(msg kafka.Message, consumer string, cause error, attempts int) kafka.Message {
+	headers := make([]kafka.Header, 0, len(msg.Headers)+7)
+	for _, h := range msg.Headers {
+		// Headers of an earlier dead-lettering are replaced, so a replayed message that fails again
+		// describes its latest failure.
+		if !IsDeadLetterHeader(h.Key) {
+			headers = append(headers, h)
+		}
+	}
+	headers = append(headers,
+		kafka.Header{Key: HeaderOriginalTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		kafka.Header{Key: HeaderConsumer, Value: []byte(consumer)},
+		kafka.Header{Key: HeaderError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: HeaderFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+	)
+
+	return kafka.Message{
+		Topic:   DeadLetterTopic(msg.Topic),
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	}
+}
+
+// IsDeadLetterHeader reports whether a header was added when dead-lettering a message.
+func IsDeadLetterHeader(key string) bool {
+	switch key {
+	case HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset, HeaderConsumer, HeaderError, HeaderAttempts, HeaderFailedAt:
+		return true
+	}
+	return false
+}
+
+// HeaderValue returns the value of the first header with the given key, or "".
+func HeaderValue(msg kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,208 @@
+package kafka
+
+import (
+	"context"
+	"hash/fnv"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MemoryBus is an in-process Publisher with subscribers, for tests and for running several
+// components in one process without a broker. Like Kafka, it keeps every message, spreads the
+// messages of a topic over partitions by key, and tracks the committed offsets of each consumer
+// group. Each partition is consumed by one subscriber of a group at a time. Messages a subscriber
+// fetched but did not commit are delivered again once it is closed, as after a rebalance.
+type MemoryBus struct {
+	partitions int
+
+	mu      sync.Mutex
+	topics  map[string][][]kafka.Message // Messages by topic and partition; the index is the offset.
+	groups  map[string]*memoryGroup      // Keyed by topic and group ID.
+	changed chan struct{}                // Closed and replaced whenever messages are published or redelivered.
+}
+
+// memoryGroup holds the offsets and members of one consumer group on one topic.
+type memoryGroup struct {
+	next      []int64             // Next offset to deliver, by partition.
+	committed []int64             // First offset not committed, by partition.
+	owner     []*memorySubscriber // Member consuming each partition, nil if none does.
+	members   int
+}
+
+// NewMemoryBus creates a bus whose topics have the given number of partitions.
+func NewMemoryBus(partitions int) *MemoryBus {
+	if partitions < 1 {
+		partitions = 1
+	}
+	return &MemoryBus{
+		partitions: partitions,
+		topics:     make(map[string][][]kafka.Message),
+		groups:     make(map[string]*memoryGroup),
+		changed:    make(chan struct{}),
+	}
+}
+
+// Publish appends the messages to their topics. Messages with the same key go to the same partition.
+func (b *MemoryBus) Publish(ctx context.Context, msgs ...kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for _, msg := range msgs {
+		log := b.topic(msg.Topic)
+		msg.Partition = b.partition(msg.Key)
+		msg.Offset = int64(len(log[msg.Partition]))
+		if msg.Time.IsZero() {
+			msg.Time = now
+		}
+		log[msg.Partition] = append(log[msg.Partition], msg)
+	}
+	b.notify()
+	return nil
+}
+
+// Subscribe returns a subscriber of the topic in the consumer group. Subscribers of the same group
+// share the messages of the topic; every group receives all of them, starting with the first.
+func (b *MemoryBus) Subscribe(topic, groupID string) Subscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.topic(topic)
+	key := topic + "/" + groupID
+	group, ok := b.groups[key]
+	if !ok {
+		group = &memoryGroup{
+			next:      make([]int64, b.partitions),
+			committed: make([]int64, b.partitions),
+			owner:     make([]*memorySubscriber, b.partitions),
+		}
+		b.groups[key] = group
+	}
+	group.members++
+	return &memorySubscriber{bus: b, topic: topic, group: group, closed: make(chan struct{})}
+}
+
+// topic returns the partitions of a topic, creating it if needed. The caller must hold the lock.
+func (b *MemoryBus) topic(name string) [][]kafka.Message {
+	log, ok := b.topics[name]
+	if !ok {
+		log = make([][]kafka.Message, b.partitions)
+		b.topics[name] = log
+	}
+	return log
+}
+
+// partition picks the partition of a key. Messages without a key go to the first partition.
+func (b *MemoryBus) partition(key []byte) int {
+	if len(key) == 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(b.partitions))
+}
+
+// notify wakes up the subscribers waiting for messages. The caller must hold the lock.
+func (b *MemoryBus) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+type memorySubscriber struct {
+	bus       *MemoryBus
+	topic     string
+	group     *memoryGroup
+	closeOnce sync.Once
+	closed    chan struct{}
+	last      int // Partition of the last fetch, so partitions take turns.
+}
+
+func (s *memorySubscriber) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		s.bus.mu.Lock()
+		log := s.bus.topics[s.topic]
+		for i := 1; i <= len(log); i++ {
+			p := (s.last + i) % len(log)
+			if next := s.group.next[p]; next < int64(len(log[p])) && s.claim(p) {
+				s.group.next[p]++
+				s.last = p
+				s.bus.mu.Unlock()
+				return log[p][next], nil
+			}
+		}
+		changed := s.bus.changed
+		s.bus.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-s.closed:
+			return kafka.Message{}, io.EOF
+		case <-changed:
+		}
+	}
+}
+
+// claim reports whether the subscriber consumes the partition, taking it over if no member does
+// and the subscriber has less than its share of the partitions. The caller must hold the lock.
+func (s *memorySubscriber) claim(p int) bool {
+	switch s.group.owner[p] {
+	case s:
+		return true
+	case nil:
+		owned := 0
+		for _, owner := range s.group.owner {
+			if owner == s {
+				owned++
+			}
+		}
+		share := (len(s.group.owner) + s.group.members - 1) / s.group.members
+		if owned >= share {
+			return false
+		}
+		s.group.owner[p] = s
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *memorySubscriber) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	for _, msg := range msgs {
+		if msg.Offset+1 > s.group.committed[msg.Partition] {
+			s.group.committed[msg.Partition] = msg.Offset + 1
+		}
+	}
+	return nil
+}
+
+// Close leaves the group and releases its partitions to the other members. Messages of those
+// partitions that were fetched but not committed are delivered again. Messages the other members
+// are handling stay with them.
+func (s *memorySubscriber) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+
+		s.bus.mu.Lock()
+		defer s.bus.mu.Unlock()
+		for p, owner := range s.group.owner {
+			if owner == s {
+				s.group.next[p] = s.group.committed[p]
+				s.group.owner[p] = nil
+			}
+		}
+		s.group.members--
+		s.bus.notify()
+	})
+	return nil
+}
@@ -0,0 +1,123 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fetch fetches the next message, failing the test if none arrives in time.
+func fetch(t *testing.T, s Subscriber) kafka.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := s.FetchMessage(ctx)
+	if err != nil {
+		t.Fatalf("FetchMessage: %v", err)
+	}
+	return msg
+}
+
+// expectNone fails the test if the subscriber receives a message.
+func expectNone(t *testing.T, s Subscriber) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if msg, err := s.FetchMessage(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("FetchMessage = %q, %v; want no message", msg.Value, err)
+	}
+}
+
+// keyFor returns a key that the bus puts in the partition.
+func keyFor(t *testing.T, b *MemoryBus, partition int) []byte {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		if key := []byte(fmt.Sprintf("key-%d", i)); b.partition(key) == partition {
+			return key
+		}
+	}
+	t.Fatalf("no key for partition %d", partition)
+	return nil
+}
+
+func TestMemoryBusDeliversTopicToEveryGroup(t *testing.T) {
+	ctx := context.Background()
+	bus := NewMemoryBus(1)
+	orchestration := bus.Subscribe("match_found", "orchestration")
+	gateway := bus.Subscribe("match_found", "gateway")
+
+	err := bus.Publish(ctx,
+		kafka.Message{Topic: "match_found", Value: []byte("m1")},
+		kafka.Message{Topic: "server_ready", Value: []byte("s1")},
+		kafka.Message{Topic: "match_found", Value: []byte("m2")},
+	)
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	for _, s := range []Subscriber{orchestration, gateway} {
+		for i, want := range []string{"m1", "m2"} {
+			msg := fetch(t, s)
+			if string(msg.Value) != want || msg.Offset != int64(i) {
+				t.Fatalf("got %q at offset %d, want %q at offset %d", msg.Value, msg.Offset, want, i)
+			}
+		}
+		expectNone(t, s)
+	}
+}
+
+func TestMemoryBusRedeliversUncommittedMessages(t *testing.T) {
+	ctx := context.Background()
+	bus := NewMemoryBus(1)
+	first := bus.Subscribe("topic", "group")
+	bus.Publish(ctx, kafka.Message{Topic: "topic", Value: []byte("a")}, kafka.Message{Topic: "topic", Value: []byte("b")})
+
+	if err := first.CommitMessages(ctx, fetch(t, first)); err != nil {
+		t.Fatalf("CommitMessages: %v", err)
+	}
+	fetch(t, first) // Fetched but never committed.
+	first.Close()
+
+	second := bus.Subscribe("topic", "group")
+	if msg := fetch(t, second); string(msg.Value) != "b" {
+		t.Fatalf("got %q, want the uncommitted message b", msg.Value)
+	}
+	expectNone(t, second)
+}
+
+func TestMemoryBusCloseOnlyRewindsOwnPartitions(t *testing.T) {
+	ctx := context.Background()
+	bus := NewMemoryBus(2)
+	leaving := bus.Subscribe("topic", "group")
+	staying := bus.Subscribe("topic", "group")
+	bus.Publish(ctx,
+		kafka.Message{Topic: "topic", Key: keyFor(t, bus, 0), Value: []byte("p0")},
+		kafka.Message{Topic: "topic", Key: keyFor(t, bus, 1), Value: []byte("p1")},
+	)
+
+	// Each member takes one of the two partitions, and neither commits.
+	left, kept := fetch(t, leaving), fetch(t, staying)
+	if left.Partition == kept.Partition {
+		t.Fatalf("both members got partition %d, want one partition each", kept.Partition)
+	}
+	expectNone(t, staying)
+
+	leaving.Close()
+
+	// Only the message of the partition that was released is delivered again.
+	if msg := fetch(t, staying); string(msg.Value) != string(left.Value) {
+		t.Fatalf("got %q, want %q of the released partition", msg.Value, left.Value)
+	}
+	expectNone(t, staying)
+	staying.Close()
+
+	// Both messages are still uncommitted, so a new member receives both.
+	next := bus.Subscribe("topic", "group")
+	fetch(t, next)
+	fetch(t, next)
+	expectNone(t, next)
+}
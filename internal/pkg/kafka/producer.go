@@ -1,24 +1,74 @@
 package kafka
 
 import (
-	"log/slog"
+	"context"
+	"time"
 
 	"github.com/segmentio/kafka-go"
 )
 
-// NewProducer initializes and returns a new Kafka writer (producer).
-func NewProducer(brokers []string, topic string) *kafka.Writer {
-	return &kafka.Writer{
-		Addr:     kafka.TCP(brokers...),
-		Topic:    topic,
-		Balancer: &kafka.LeastBytes{},
-		// Additional configurations for robustness:
-		RequiredAcks: kafka.RequireOne, // Acknowledge after leader has written.
-		Async:        true,             // Asynchronous writes for higher throughput.
-		Completion: func(messages []kafka.Message, err error) {
-			if err != nil {
-				slog.Error("Kafka async write failed", "error", err)
-			}
+// ProducerConfig holds the settings of a Producer.
+type ProducerConfig struct {
+	Brokers []string
+	// RequiredAcks is "all", "one" or "none". "all", the default, waits until every in-sync
+	// replica has the message, so an acknowledged message survives the loss of the leader.
+	RequiredAcks string
+	// MaxAttempts is how often a write is attempted before Publish fails.
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the delay between attempts.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds a Publish call, including its retries. Zero leaves it to the caller's context.
+	Timeout time.Duration
+	// AllowAutoTopicCreation creates missing topics on the first write.
+	AllowAutoTopicCreation bool
+}
+
+// Producer publishes messages synchronously: Publish returns once Kafka has acknowledged them,
+// so callers know whether a message was delivered and can react to a failure.
+type Producer struct {
+	writer  *kafka.Writer
+	timeout time.Duration
+}
+
+// NewProducer creates a producer. It has no topic of its own; every message names its topic.
+func NewProducer(config ProducerConfig) (*Producer, error) {
+	acks := kafka.RequireAll
+	if config.RequiredAcks != "" {
+		if err := acks.UnmarshalText([]byte(config.RequiredAcks)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Producer{
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(config.Brokers...),
+			Balancer:               &kafka.Hash{}, // Messages with the same key go to the same partition, which keeps them in order.
+			RequiredAcks:           acks,
+			MaxAttempts:            config.MaxAttempts,
+			WriteBackoffMin:        config.MinBackoff,
+			WriteBackoffMax:        config.MaxBackoff,
+			AllowAutoTopicCreation: config.AllowAutoTopicCreation,
+			// A synchronous write waits for its batch to fill up or time out, so a short timeout
+			// keeps single messages from waiting for the default second.
+			BatchTimeout: 10 * time.Millisecond,
 		},
+		timeout: config.Timeout,
+	}, nil
+}
+
+// Publish writes the messages and waits until Kafka has acknowledged them, retrying failed writes
+// with backoff. If only some messages fail, the error is a kafka.WriteErrors with one entry per message.
+func (p *Producer) Publish(ctx context.Context, msgs ...kafka.Message) error {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
 	}
+	return p.writer.WriteMessages(ctx, msgs...)
+}
+
+// Close flushes and closes the producer.
+func (p *Producer) Close() error {
+	return p.writer.Close()
 }
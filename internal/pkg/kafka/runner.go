@@ -0,0 +1,321 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Handler processes one message. Failures are retried, unless the error is wrapped with Permanent.
+type Handler func(ctx context.Context, msg kafka.Message) error
+
+// permanentError marks a failure that retrying cannot fix, like a malformed message.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps an error of a Handler to dead-letter the message right away instead of retrying it.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether the error was wrapped with Permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// RunnerConfig holds the settings of a Runner.
+type RunnerConfig struct {
+	// Name identifies the consumer in logs, metrics and dead-letter headers, e.g. "api-gateway.match_found".
+	Name string
+	// MaxAttempts is how often a message is handled before it is dead-lettered.
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the exponential delay between attempts.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Concurrency is the number of messages of one partition handled at the same time. With 1,
+	// the messages of a partition are handled in order.
+	Concurrency int
+	// DrainTimeout is how long messages already being handled may take to finish on shutdown.
+	// Messages that do not finish in time are not committed, and are redelivered after the restart.
+	DrainTimeout time.Duration
+}
+
+// consumerMetrics are published on the diagnostics server at /debug/vars, keyed by consumer name.
+var consumerMetrics = expvar.NewMap("kafka_consumer")
+
+// runnerMetrics are the counters of one runner.
+type runnerMetrics struct {
+	processed    *expvar.Int // Messages handled successfully.
+	retries      *expvar.Int // Failed attempts that were retried.
+	deadLettered *expvar.Int // Messages moved to the dead-letter topic.
+	errors       *expvar.Int // Failures to read, commit or dead-letter messages.
+}
+
+func newRunnerMetrics(name string) *runnerMetrics {
+	m := &runnerMetrics{
+		processed:    new(expvar.Int),
+		retries:      new(expvar.Int),
+		deadLettered: new(expvar.Int),
+		errors:       new(expvar.Int),
+	}
+	runner := new(expvar.Map).Init()
+	runner.Set("processed", m.processed)
+	runner.Set("retries", m.retries)
+	runner.Set("dead_lettered", m.deadLettered)
+	runner.Set("errors", m.errors)
+	consumerMetrics.Set(name, runner)
+	return m
+}
+
+// Runner consumes a topic with a handler. Messages that keep failing are moved to the dead-letter
+// topic of their topic (see DeadLetterTopic) instead of being dropped, and can be replayed from
+// there with cmd/dlq-admin. An offset is only committed once its message and every message before
+// it in the partition were handled or dead-lettered, so no message is lost when the consumer stops.
+// With the subscribers and publisher of a MemoryBus, the same handlers run without a broker.
+type Runner struct {
+	reader      Subscriber
+	deadLetters Publisher
+	handler     Handler
+	config      RunnerConfig
+	metrics     *runnerMetrics
+}
+
+// NewRunner creates a runner. A Kafka reader must belong to a consumer group and commit synchronously,
+// see NewConsumer. The dead-letter publisher can be shared, see NewDeadLetterProducer.
+func NewRunner(reader Subscriber, deadLetters Publisher, handler Handler, config RunnerConfig) *Runner {
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+	if config.Concurrency < 1 {
+		config.Concurrency = 1
+	}
+	// Without a delay, failures would be retried in a busy loop.
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = 100 * time.Millisecond
+	}
+	config.MaxBackoff = max(config.MaxBackoff, config.MinBackoff)
+	return &Runner{
+		reader:      reader,
+		deadLetters: deadLetters,
+		handler:     handler,
+		config:      config,
+		metrics:     newRunnerMetrics(config.Name),
+	}
+}
+
+// Run consumes messages until the context is cancelled, then waits for the messages being handled
+// to drain. It should be run in a goroutine.
+func (r *Runner) Run(ctx context.Context) {
+	slog.Info("Kafka consumer started", "consumer", r.config.Name, "concurrency", r.config.Concurrency)
+	defer r.reader.Close()
+
+	// Handlers run on a context of their own, which outlives ctx by the drain timeout.
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	drained := make(chan struct{})
+	go func() {
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			select {
+			case <-drained:
+			case <-time.After(r.config.DrainTimeout):
+				slog.Warn("Kafka consumer did not drain in time", "consumer", r.config.Name)
+				cancelWork()
+			}
+		}
+	}()
+
+	var inFlight sync.WaitGroup
+	partitions := make(map[int]*partitionQueue)
+	fetchBackoff := r.config.MinBackoff
+	for {
+		msg, err := r.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				break // Context cancelled, graceful shutdown.
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, kafka.ErrGroupClosed) {
+				slog.Error("Kafka reader was closed", "consumer", r.config.Name)
+				break
+			}
+			// Back off while the broker is unreachable, instead of retrying in a busy loop.
+			r.metrics.errors.Add(1)
+			slog.Error("Error reading from Kafka, retrying", "consumer", r.config.Name, "retryIn", fetchBackoff, "error", err)
+			if sleep(ctx, fetchBackoff) != nil {
+				break
+			}
+			fetchBackoff = min(fetchBackoff*2, r.config.MaxBackoff)
+			continue
+		}
+		fetchBackoff = r.config.MinBackoff
+
+		queue, ok := partitions[msg.Partition]
+		if !ok {
+			queue = newPartitionQueue(r.config.Concurrency)
+			partitions[msg.Partition] = queue
+		}
+		// Wait for a free slot of the partition. A message fetched but never started is simply
+		// not committed, and is redelivered after the restart.
+		select {
+		case queue.slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		queue.add(msg)
+		inFlight.Add(1)
+		go func() {
+			defer inFlight.Done()
+			defer func() { <-queue.slots }()
+
+			// Only a shutdown ends processing early, in which case the message is not committed.
+			if err := r.process(workCtx, msg); err == nil {
+				r.commit(workCtx, queue, msg)
+			}
+		}()
+	}
+
+	inFlight.Wait()
+	close(drained)
+	slog.Info("Kafka consumer stopped.", "consumer", r.config.Name)
+}
+
+// commit marks a message as done and commits the offsets its partition has completed. Offsets are
+// committed in order: a message finishing early waits for the messages before it.
+func (r *Runner) commit(ctx context.Context, queue *partitionQueue, msg kafka.Message) {
+	queue.mu.Lock()
+	// The lock is held while committing, so commits of a partition cannot overtake each other.
+	defer queue.mu.Unlock()
+
+	done, ok := queue.complete(msg.Offset)
+	if !ok {
+		return
+	}
+	if err := r.reader.CommitMessages(ctx, done); err != nil && ctx.Err() == nil {
+		r.metrics.errors.Add(1)
+		slog.Error("Failed to commit Kafka message", "consumer", r.config.Name, "partition", done.Partition, "offset", done.Offset, "error", err)
+	}
+}
+
+// partitionQueue tracks the messages of a partition that are being handled, in offset order.
+type partitionQueue struct {
+	slots   chan struct{} // Limits the messages handled at the same time.
+	mu      sync.Mutex
+	pending []pendingMessage
+}
+
+type pendingMessage struct {
+	msg  kafka.Message
+	done bool
+}
+
+func newPartitionQueue(concurrency int) *partitionQueue {
+	return &partitionQueue{slots: make(chan struct{}, concurrency)}
+}
+
+func (q *partitionQueue) add(msg kafka.Message) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, pendingMessage{msg: msg})
+}
+
+// complete marks the message at the offset as done and removes the done messages at the front of
+// the queue. It returns the last of them, which is the offset to commit, or false if the message
+// at the front is still being handled. The caller must hold the lock.
+func (q *partitionQueue) complete(offset int64) (kafka.Message, bool) {
+	for i := range q.pending {
+		if q.pending[i].msg.Offset == offset {
+			q.pending[i].done = true
+			break
+		}
+	}
+
+	var last kafka.Message
+	n := 0
+	for n < len(q.pending) && q.pending[n].done {
+		last = q.pending[n].msg
+		n++
+	}
+	q.pending = q.pending[n:]
+	return last, n > 0
+}
+
+// process handles a message, retrying with backoff, and dead-letters it if it still fails.
+// It only returns an error if the context is cancelled first.
+func (r *Runner) process(ctx context.Context, msg kafka.Message) error {
+	backoff := r.config.MinBackoff
+	for attempt := 1; ; attempt++ {
+		err := r.handler(ctx, msg)
+		if err == nil {
+			r.metrics.processed.Add(1)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if IsPermanent(err) || attempt == r.config.MaxAttempts {
+			return r.deadLetter(ctx, msg, err, attempt)
+		}
+
+		r.metrics.retries.Add(1)
+		slog.Warn("Failed to handle Kafka message, retrying", "consumer", r.config.Name,
+			"partition", msg.Partition, "offset", msg.Offset, "attempt", attempt, "retryIn", backoff, "error", err)
+		if err := sleep(ctx, backoff); err != nil {
+			return err
+		}
+		backoff = min(backoff*2, r.config.MaxBackoff)
+	}
+}
+
+// deadLetter writes a failed message to its dead-letter topic. The write is retried until it
+// succeeds, since the message would be lost if its offset were committed without it.
+func (r *Runner) deadLetter(ctx context.Context, msg kafka.Message, cause error, attempts int) error {
+	letter := deadLetter(msg, r.config.Name, cause, attempts)
+	backoff := r.config.MinBackoff
+	for {
+		err := r.deadLetters.Publish(ctx, letter)
+		if err == nil {
+			r.metrics.deadLettered.Add(1)
+			slog.Error("Moved Kafka message to dead-letter topic", "consumer", r.config.Name, "topic", letter.Topic,
+				"partition", msg.Partition, "offset", msg.Offset, "attempts", attempts, "error", cause)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		r.metrics.errors.Add(1)
+		slog.Error("Failed to write dead letter, retrying", "consumer", r.config.Name, "topic", letter.Topic, "retryIn", backoff, "error", err)
+		if err := sleep(ctx, backoff); err != nil {
+			return err
+		}
+		backoff = min(backoff*2, r.config.MaxBackoff)
+	}
+}
+
+// sleep waits for the duration, or returns the context's error if it is cancelled first.
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,191 @@
+// Package outbox implements the transactional outbox pattern: events are stored atomically with
+// the state change they announce, and a relay publishes them to Kafka afterwards. An event is
+// therefore published if and only if its state change was made.
+//
+// Delivery is at least once. Failed publishes are retried with backoff until they succeed, and a
+// relay that stops between publishing and acknowledging a message leaves it to be published again
+// once its lease expires. Consumers must handle duplicates, and must not rely on the order of
+// events that were retried.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	kafkautil "github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
+)
+
+// Message is an event waiting in the outbox.
+type Message struct {
+	ID      string // Assigned by the store.
+	Topic   string
+	Key     []byte
+	Payload []byte
+	// Attempts counts the failed publishes so far.
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// Store holds the messages of an outbox. Claimed messages are hidden from other relays for the
+// duration of the lease, so several relays can share a store without publishing the same message twice.
+type Store interface {
+	// Claim leases up to limit messages that are due, oldest first.
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]*Message, error)
+	// Ack removes published messages.
+	Ack(ctx context.Context, messages []*Message) error
+	// Retry records a failed publish and makes the message due again after the delay.
+	Retry(ctx context.Context, message *Message, delay time.Duration) error
+}
+
+// RelayConfig holds the settings of a Relay.
+type RelayConfig struct {
+	// Name identifies the relay in logs and metrics, e.g. "auth".
+	Name string
+	// PollInterval is how long the relay waits when no message is due.
+	PollInterval time.Duration
+	// BatchSize is the maximum number of messages published at once.
+	BatchSize int
+	// Lease is how long claimed messages are hidden from other relays. It must exceed the time
+	// a publish takes, or messages are published twice.
+	Lease time.Duration
+	// MinBackoff and MaxBackoff bound the exponential delay before a failed message is retried.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// metrics are published on the diagnostics server at /debug/vars, keyed by relay name.
+var metrics = expvar.NewMap("outbox")
+
+// relayMetrics are the counters of one relay.
+type relayMetrics struct {
+	published *expvar.Int   // Messages acknowledged by Kafka.
+	failed    *expvar.Int   // Failed publish attempts, each followed by a retry.
+	errors    *expvar.Int   // Failures of the store itself.
+	lag       *expvar.Float // Seconds between enqueueing and publishing the last published message.
+}
+
+func newRelayMetrics(name string) *relayMetrics {
+	m := &relayMetrics{
+		published: new(expvar.Int),
+		failed:    new(expvar.Int),
+		errors:    new(expvar.Int),
+		lag:       new(expvar.Float),
+	}
+	relay := new(expvar.Map).Init()
+	relay.Set("published", m.published)
+	relay.Set("publish_failures", m.failed)
+	relay.Set("store_errors", m.errors)
+	relay.Set("lag_seconds", m.lag)
+	metrics.Set(name, relay)
+	return m
+}
+
+// Relay publishes the messages of a store to Kafka.
+type Relay struct {
+	store    Store
+	producer kafkautil.Publisher
+	config   RelayConfig
+	metrics  *relayMetrics
+}
+
+// NewRelay creates a relay, usually publishing with a kafka.Producer. Messages the producer fails
+// to deliver after its own retries are retried by the relay, with the backoff of the config.
+func NewRelay(store Store, producer kafkautil.Publisher, config RelayConfig) *Relay {
+	return &Relay{
+		store:    store,
+		producer: producer,
+		config:   config,
+		metrics:  newRelayMetrics(config.Name),
+	}
+}
+
+// Run publishes messages until the context is cancelled. It should be run in a goroutine.
+func (r *Relay) Run(ctx context.Context) {
+	slog.Info("Outbox relay started", "relay", r.config.Name)
+	for {
+		claimed, err := r.publishBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.metrics.errors.Add(1)
+			slog.Error("Outbox relay failed", "relay", r.config.Name, "error", err)
+		}
+
+		// A full batch suggests more messages are due, so the next one is claimed right away.
+		if err == nil && claimed == r.config.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Outbox relay stopped.", "relay", r.config.Name)
+			return
+		case <-time.After(r.config.PollInterval):
+		}
+	}
+}
+
+// publishBatch claims due messages, publishes them and acknowledges the ones Kafka accepted.
+// The others are scheduled for a retry. It returns the number of messages claimed.
+func (r *Relay) publishBatch(ctx context.Context) (int, error) {
+	messages, err := r.store.Claim(ctx, r.config.BatchSize, r.config.Lease)
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
+
+	batch := make([]kafka.Message, len(messages))
+	for i, msg := range messages {
+		batch[i] = kafka.Message{Topic: msg.Topic, Key: msg.Key, Value: msg.Payload}
+	}
+
+	// The producer reports failures per message, so a partial failure only retries the messages that failed.
+	writeErr := r.producer.Publish(ctx, batch...)
+	var perMessage kafka.WriteErrors
+	if writeErr != nil && !errors.As(writeErr, &perMessage) {
+		perMessage = make(kafka.WriteErrors, len(messages))
+		for i := range perMessage {
+			perMessage[i] = writeErr
+		}
+	}
+
+	var published []*Message
+	for i, msg := range messages {
+		if perMessage != nil && perMessage[i] != nil {
+			r.retry(ctx, msg, perMessage[i])
+			continue
+		}
+		published = append(published, msg)
+	}
+
+	if len(published) > 0 {
+		if err := r.store.Ack(ctx, published); err != nil {
+			// The messages are published again once their lease expires.
+			return len(messages), err
+		}
+		r.metrics.published.Add(int64(len(published)))
+		r.metrics.lag.Set(time.Since(published[len(published)-1].CreatedAt).Seconds())
+	}
+
+	return len(messages), nil
+}
+
+// retry schedules a message that failed to publish, with exponential backoff.
+func (r *Relay) retry(ctx context.Context, msg *Message, cause error) {
+	r.metrics.failed.Add(1)
+
+	delay := r.config.MinBackoff << min(msg.Attempts, 16)
+	if delay <= 0 || delay > r.config.MaxBackoff {
+		delay = r.config.MaxBackoff
+	}
+	slog.Warn("Failed to publish outbox message, retrying", "relay", r.config.Name, "topic", msg.Topic,
+		"messageID", msg.ID, "attempts", msg.Attempts+1, "retryIn", delay, "error", cause)
+
+	if err := r.store.Retry(ctx, msg, delay); err != nil {
+		// The message becomes due again once its lease expires.
+		r.metrics.errors.Add(1)
+		slog.Error("Failed to schedule outbox retry", "relay", r.config.Name, "messageID", msg.ID, "error", err)
+	}
+}
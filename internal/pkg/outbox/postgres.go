@@ -0,0 +1,89 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Execer is implemented by *sql.Tx. Enqueue accepts it so that it can run inside the caller's transaction.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// PostgresStore keeps the outbox in the "outbox" table, for services whose state lives in PostgreSQL.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Enqueue stores a message in the outbox. It must be called with the transaction that makes
+// the change the message announces.
+func (s *PostgresStore) Enqueue(ctx context.Context, tx Execer, msg Message) error {
+	query := `
+		INSERT INTO outbox (topic, key, payload)
+		VALUES ($1, $2, $3);`
+
+	if _, err := tx.ExecContext(ctx, query, msg.Topic, msg.Key, msg.Payload); err != nil {
+		slog.Error("Failed to enqueue outbox message", "topic", msg.Topic, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Claim leases due messages by moving their next attempt past the lease.
+// SKIP LOCKED lets concurrent relays claim other messages instead of waiting.
+func (s *PostgresStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]*Message, error) {
+	query := `
+		UPDATE outbox
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE next_attempt_at <= NOW()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, topic, key, payload, attempts, created_at;`
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.ID, &msg.Topic, &msg.Key, &msg.Payload, &msg.Attempts, &msg.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, &msg)
+	}
+	return messages, rows.Err()
+}
+
+func (s *PostgresStore) Ack(ctx context.Context, messages []*Message) error {
+	ids := make([]string, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM outbox WHERE id = ANY($1::bigint[]);`, pq.Array(ids))
+	return err
+}
+
+func (s *PostgresStore) Retry(ctx context.Context, msg *Message, delay time.Duration) error {
+	query := `
+		UPDATE outbox
+		SET attempts = attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2)
+		WHERE id = $1;`
+
+	_, err := s.db.ExecContext(ctx, query, msg.ID, delay.Seconds())
+	return err
+}
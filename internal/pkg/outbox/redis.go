@@ -0,0 +1,171 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/segmentio/kafka-go"
+
+	kafkautil "github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
+)
+
+// RedisStore keeps the outbox in Redis, for services whose state lives in Redis. Messages are
+// stored in a hash, and a sorted set orders their IDs by the time they are due.
+type RedisStore struct {
+	rdb         *redis.Client
+	dueKey      string
+	messagesKey string
+}
+
+// NewRedisStore creates a store under the given key prefix, e.g. "matchmaking:outbox".
+func NewRedisStore(rdb *redis.Client, keyPrefix string) *RedisStore {
+	return &RedisStore{
+		rdb:         rdb,
+		dueKey:      keyPrefix + ":due",
+		messagesKey: keyPrefix + ":messages",
+	}
+}
+
+// storedMessage is the representation of a message in the hash.
+type storedMessage struct {
+	Topic     string    `json:"topic"`
+	Key       []byte    `json:"key,omitempty"`
+	Payload   []byte    `json:"payload"`
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Enqueue queues the commands that store a message on a transaction pipeline (MULTI/EXEC),
+// next to the commands of the state change the message announces.
+func (s *RedisStore) Enqueue(ctx context.Context, tx redis.Pipeliner, msg Message) error {
+	now := time.Now()
+	data, err := json.Marshal(storedMessage{Topic: msg.Topic, Key: msg.Key, Payload: msg.Payload, CreatedAt: now})
+	if err != nil {
+		return err
+	}
+
+	id := uuid.New().String()
+	tx.HSet(ctx, s.messagesKey, id, data)
+	tx.ZAdd(ctx, s.dueKey, redis.Z{Score: float64(now.UnixMilli()), Member: id})
+	return nil
+}
+
+// Publish stores messages on their own, for events that do not accompany a change of Redis state.
+// It makes the store a kafka.Publisher whose messages reach Kafka through the relay.
+func (s *RedisStore) Publish(ctx context.Context, msgs ...kafka.Message) error {
+	_, err := s.rdb.TxPipelined(ctx, func(tx redis.Pipeliner) error {
+		return s.InTx(tx).Publish(ctx, msgs...)
+	})
+	return err
+}
+
+// InTx returns a kafka.Publisher that queues the messages on a transaction pipeline, see Enqueue.
+func (s *RedisStore) InTx(tx redis.Pipeliner) kafkautil.Publisher {
+	return &txPublisher{store: s, tx: tx}
+}
+
+type txPublisher struct {
+	store *RedisStore
+	tx    redis.Pipeliner
+}
+
+func (p *txPublisher) Publish(ctx context.Context, msgs ...kafka.Message) error {
+	for _, msg := range msgs {
+		if err := p.store.Enqueue(ctx, p.tx, Message{Topic: msg.Topic, Key: msg.Key, Payload: msg.Value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claimScript leases the due message IDs atomically, so concurrent relays never claim the same message.
+var claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[3], id)
+end
+return ids
+`)
+
+func (s *RedisStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]*Message, error) {
+	now := time.Now()
+	ids, err := claimScript.Run(ctx, s.rdb, []string{s.dueKey},
+		now.UnixMilli(), limit, now.Add(lease).UnixMilli()).StringSlice()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	values, err := s.rdb.HMGet(ctx, s.messagesKey, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*Message, 0, len(ids))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			// Acknowledged by another relay in the meantime.
+			s.rdb.ZRem(ctx, s.dueKey, ids[i])
+			continue
+		}
+		var stored storedMessage
+		if err := json.Unmarshal([]byte(data), &stored); err != nil {
+			return nil, fmt.Errorf("decoding outbox message %s: %w", ids[i], err)
+		}
+		messages = append(messages, &Message{
+			ID:        ids[i],
+			Topic:     stored.Topic,
+			Key:       stored.Key,
+			Payload:   stored.Payload,
+			Attempts:  stored.Attempts,
+			CreatedAt: stored.CreatedAt,
+		})
+	}
+	return messages, nil
+}
+
+func (s *RedisStore) Ack(ctx context.Context, messages []*Message) error {
+	ids := make([]string, len(messages))
+	members := make([]interface{}, len(messages))
+	for i, msg := range messages {
+		ids[i], members[i] = msg.ID, msg.ID
+	}
+
+	_, err := s.rdb.TxPipelined(ctx, func(tx redis.Pipeliner) error {
+		tx.ZRem(ctx, s.dueKey, members...)
+		tx.HDel(ctx, s.messagesKey, ids...)
+		return nil
+	})
+	return err
+}
+
+// retryScript reschedules a message only if it is still in the outbox. Once its lease has expired,
+// another relay may have published and acknowledged it, and it must not be brought back.
+var retryScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[1])
+return 1
+`)
+
+func (s *RedisStore) Retry(ctx context.Context, msg *Message, delay time.Duration) error {
+	data, err := json.Marshal(storedMessage{
+		Topic:     msg.Topic,
+		Key:       msg.Key,
+		Payload:   msg.Payload,
+		Attempts:  msg.Attempts + 1,
+		CreatedAt: msg.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	return retryScript.Run(ctx, s.rdb, []string{s.messagesKey, s.dueKey},
+		msg.ID, data, time.Now().Add(delay).UnixMilli()).Err()
+}
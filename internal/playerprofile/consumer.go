@@ -0,0 +1,107 @@
+package playerprofile
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/events"
+	kafkautil "github.com/cheildo/nexus-clash-backend/internal/pkg/kafka"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
+)
+
+// RegistrationConsumer creates a profile for every user the auth service registers.
+// Events may be delivered more than once, which EnsureProfile tolerates.
+type RegistrationConsumer struct {
+	codec *events.Codec
+	svc   Service
+}
+
+func NewRegistrationConsumer(codec *events.Codec, svc Service) *RegistrationConsumer {
+	return &RegistrationConsumer{
+		codec: codec,
+		svc:   svc,
+	}
+}
+
+// HandleMessage handles a user_registered event. It is run by a kafka.Runner, which dead-letters
+// malformed events. Failures to create the profile are retried here without limit instead, since
+// while the database is unavailable every event would fail.
+func (rc *RegistrationConsumer) HandleMessage(ctx context.Context, msg kafka.Message) error {
+	event := &nexusclashv1.UserRegisteredEvent{}
+	if _, err := rc.codec.Decode(msg.Value, event); err != nil {
+		return kafkautil.Permanent(err)
+	}
+	return rc.handle(ctx, event)
+}
+
+// handle creates the profile, retrying while the failure may be temporary.
+func (rc *RegistrationConsumer) handle(ctx context.Context, event *nexusclashv1.UserRegisteredEvent) error {
+	userID := event.GetUserId().GetValue()
+	return retryProfileChange(ctx, "create profile for new user", userID, func() error {
+		return rc.svc.EnsureProfile(ctx, userID, event.GetUsername())
+	})
+}
+
+// DeletionConsumer anonymizes the profile of every player who deletes their account.
+// Events may be delivered more than once, which AnonymizeProfile tolerates.
+type DeletionConsumer struct {
+	codec *events.Codec
+	svc   Service
+}
+
+func NewDeletionConsumer(codec *events.Codec, svc Service) *DeletionConsumer {
+	return &DeletionConsumer{
+		codec: codec,
+		svc:   svc,
+	}
+}
+
+// HandleMessage handles an account_deleted event. Like RegistrationConsumer.HandleMessage, it
+// retries failures to update the profile without limit.
+func (dc *DeletionConsumer) HandleMessage(ctx context.Context, msg kafka.Message) error {
+	event := &nexusclashv1.AccountDeletedEvent{}
+	if _, err := dc.codec.Decode(msg.Value, event); err != nil {
+		return kafkautil.Permanent(err)
+	}
+
+	userID := event.GetUserId().GetValue()
+	return retryProfileChange(ctx, "anonymize profile of deleted user", userID, func() error {
+		return dc.svc.AnonymizeProfile(ctx, userID)
+	})
+}
+
+// retryProfileChange runs a change to a profile, retrying with backoff while the failure may be
+// temporary. It only returns an error if the event is invalid, the username is not available, or
+// the context is cancelled first.
+func retryProfileChange(ctx context.Context, action, userID string, change func() error) error {
+	backoff := time.Second
+	for {
+		err := change()
+		if err == nil {
+			return nil
+		}
+		// The account was purged in the meantime, so there is nothing left to do.
+		if errors.Is(err, ErrUserNotFound) {
+			slog.Warn("Skipping profile change for user that no longer exists", "action", action, "userID", userID)
+			return nil
+		}
+		// Retrying cannot fix a malformed event, nor free a username that is still taken after
+		// EnsureProfile fell back to another name.
+		if errors.Is(err, ErrInvalidProfile) || errors.Is(err, ErrUsernameNotAvailable) {
+			return kafkautil.Permanent(err)
+		}
+		slog.Error("Failed to change profile, retrying", "action", action, "userID", userID, "retryIn", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+}
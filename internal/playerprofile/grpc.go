@@ -8,6 +8,8 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/cheildo/nexus-clash-backend/internal/auth"
+
 	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
 )
 
@@ -28,6 +30,12 @@ func (h *GRPCHandler) CreateProfile(ctx context.Context, req *nexusclashv1.Creat
 		if errors.Is(err, ErrUsernameNotAvailable) {
 			return nil, status.Error(codes.AlreadyExists, err.Error())
 		}
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, auth.ErrInvalidUsername) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		// Add other specific error mappings here
 		return nil, status.Error(codes.Internal, "failed to create profile")
 	}
@@ -48,3 +56,22 @@ func (h *GRPCHandler) GetProfile(ctx context.Context, req *nexusclashv1.GetProfi
 
 	return &nexusclashv1.GetProfileResponse{Profile: profile}, nil
 }
+
+func (h *GRPCHandler) UpdateProfile(ctx context.Context, req *nexusclashv1.UpdateProfileRequest) (*nexusclashv1.UpdateProfileResponse, error) {
+	slog.Info("gRPC UpdateProfile request received", "userID", req.GetUserId().GetValue(), "mask", req.GetUpdateMask().GetPaths())
+
+	profile, err := h.svc.UpdateProfile(ctx, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidUpdate):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, ErrProfileNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, ErrUsernameNotAvailable):
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to update profile")
+	}
+
+	return &nexusclashv1.UpdateProfileResponse{Profile: profile}, nil
+}
@@ -3,14 +3,19 @@ package playerprofile
 import (
 	"context"
 	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 
 	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
+	"github.com/cheildo/nexus-clash-backend/internal/auth"
 )
 
 // HTTPHandler holds dependencies for profile-related HTTP requests.
@@ -70,3 +75,109 @@ func (h *HTTPHandler) HandleGetProfile(w http.ResponseWriter, r *http.Request) {
 
 	h.writeJSON(w, http.StatusOK, resp.GetProfile())
 }
+
+// maxUpdateBodyBytes bounds the body of a profile update.
+const maxUpdateBodyBytes = 1 << 16
+
+// decodeUpdateRequest reads an UpdateProfileRequest in the protobuf JSON mapping, in which
+// "update_mask" is a comma-separated string of paths, e.g. "stats.kills,stats.deaths".
+func decodeUpdateRequest(r *http.Request) (*nexusclashv1.UpdateProfileRequest, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxUpdateBodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	req := &nexusclashv1.UpdateProfileRequest{}
+	if err := protojson.Unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// HandleUpdateProfile is the HTTP handler for PATCH /profiles/{userID}.
+// Players may only rename themselves: the body carries "username" and an optional "update_mask".
+// Stats are recorded by the game and can only be corrected by admins, see HandleAdminUpdateProfile.
+func (h *HTTPHandler) HandleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if userID == "" {
+		h.writeError(w, http.StatusBadRequest, "User ID is required in the URL path")
+		return
+	}
+
+	// Players may only edit their own profile.
+	if authUserID, _ := auth.UserIDFromContext(r.Context()); authUserID != userID {
+		h.writeError(w, http.StatusForbidden, "You can only update your own profile")
+		return
+	}
+
+	req, err := decodeUpdateRequest(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.GetStats() != nil {
+		h.writeError(w, http.StatusForbidden, "Stats cannot be changed")
+		return
+	}
+	for _, path := range req.GetUpdateMask().GetPaths() {
+		if path != "username" {
+			h.writeError(w, http.StatusForbidden, "Only the username can be changed")
+			return
+		}
+	}
+
+	// Only the username is forwarded, whatever else the body holds.
+	h.updateProfile(w, r, userID, &nexusclashv1.UpdateProfileRequest{
+		Username:   req.GetUsername(),
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"username"}},
+	})
+}
+
+// HandleAdminUpdateProfile is the HTTP handler for PATCH /admin/profiles/{userID}.
+// It accepts the same body as HandleUpdateProfile plus "stats", for any player.
+// The route must be restricted to admins.
+func (h *HTTPHandler) HandleAdminUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if userID == "" {
+		h.writeError(w, http.StatusBadRequest, "User ID is required in the URL path")
+		return
+	}
+
+	req, err := decodeUpdateRequest(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	adminID, _ := auth.UserIDFromContext(r.Context())
+	slog.Info("Admin profile update", "adminID", adminID, "userID", userID, "paths", req.GetUpdateMask().GetPaths())
+
+	h.updateProfile(w, r, userID, req)
+}
+
+// updateProfile forwards an already authorized update to the player-profile-service.
+func (h *HTTPHandler) updateProfile(w http.ResponseWriter, r *http.Request, userID string, req *nexusclashv1.UpdateProfileRequest) {
+	// The path parameter is authoritative; any user_id in the body is ignored.
+	req.UserId = &nexusclashv1.UUID{Value: userID}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	resp, err := h.profileClient.UpdateProfile(ctx, req)
+	if err != nil {
+		st, _ := status.FromError(err)
+		switch st.Code() {
+		case codes.InvalidArgument:
+			h.writeError(w, http.StatusBadRequest, st.Message())
+		case codes.NotFound:
+			h.writeError(w, http.StatusNotFound, st.Message())
+		case codes.AlreadyExists:
+			h.writeError(w, http.StatusConflict, st.Message())
+		default:
+			h.writeError(w, http.StatusInternalServerError, "Failed to update profile")
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, resp.GetProfile())
+}
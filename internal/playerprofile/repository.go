@@ -4,29 +4,60 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log/slog"
+	"strings"
 
-	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
 	"github.com/lib/pq"
+
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/events"
+	"github.com/cheildo/nexus-clash-backend/internal/pkg/outbox"
+
+	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
 )
 
 var (
 	ErrProfileNotFound      = errors.New("profile not found")
 	ErrUsernameNotAvailable = errors.New("username is not available")
+	ErrInvalidUpdate        = errors.New("invalid profile update")
+	ErrUserNotFound         = errors.New("user does not exist")
+	ErrInvalidProfile       = errors.New("invalid profile")
 )
 
+// ProfileUpdate describes a partial update of a profile.
+// Only the non-nil fields are written; everything else is left untouched.
+type ProfileUpdate struct {
+	Username *string
+	Kills    *int32
+	Deaths   *int32
+	Assists  *int32
+	Wins     *int32
+	Losses   *int32
+}
+
 // Repository defines the database operations for player profiles.
 type Repository interface {
 	CreateProfile(ctx context.Context, userID, username string) (*nexusclashv1.Profile, error)
+	CreateProfileIfMissing(ctx context.Context, userID, username string, announce bool) (bool, error)
 	GetProfile(ctx context.Context, userID string) (*nexusclashv1.Profile, error)
+	UpdateProfile(ctx context.Context, userID string, update ProfileUpdate) (*nexusclashv1.Profile, error)
+	AnonymizeProfile(ctx context.Context, userID string) error
+}
+
+// EventTopics are the Kafka topics of the events the repository writes to the outbox.
+type EventTopics struct {
+	ProfileUpdated string
 }
 
 type postgresRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	outbox *outbox.PostgresStore
+	topics EventTopics
+	codec  *events.Codec
 }
 
-func NewRepository(db *sql.DB) Repository {
-	return &postgresRepository{db: db}
+func NewRepository(db *sql.DB, topics EventTopics, codec *events.Codec) Repository {
+	return &postgresRepository{db: db, outbox: outbox.NewPostgresStore(db), topics: topics, codec: codec}
 }
 
 // CreateProfile inserts a new player profile into the database.
@@ -50,7 +81,7 @@ func (r *postgresRepository) CreateProfile(ctx context.Context, userID, username
 				return nil, ErrUsernameNotAvailable
 			}
 			if pqErr.Code.Name() == "foreign_key_violation" {
-				return nil, errors.New("user does not exist")
+				return nil, ErrUserNotFound
 			}
 		}
 		slog.Error("Failed to create profile in database", "error", err)
@@ -62,6 +93,79 @@ func (r *postgresRepository) CreateProfile(ctx context.Context, userID, username
 	return p, nil
 }
 
+// CreateProfileIfMissing inserts a new player profile unless the user already has one.
+// It reports whether a profile was created, so it can safely be repeated for the same user.
+// With announce, a created profile's username is announced with a profile_updated event, written
+// to the outbox in the same transaction, for names the auth service does not know yet.
+func (r *postgresRepository) CreateProfileIfMissing(ctx context.Context, userID, username string, announce bool) (bool, error) {
+	query := `
+		INSERT INTO profiles (user_id, username)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO NOTHING;`
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin profile creation", "error", err)
+		return false, err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, userID, username)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			// The user already has a profile at this point, so this can only be another player's username.
+			if pqErr.Code.Name() == "unique_violation" {
+				return false, ErrUsernameNotAvailable
+			}
+			if pqErr.Code.Name() == "foreign_key_violation" {
+				return false, ErrUserNotFound
+			}
+		}
+		slog.Error("Failed to create profile in database", "error", err)
+		return false, err
+	}
+
+	created, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if created > 0 && announce {
+		event := &nexusclashv1.ProfileUpdatedEvent{UserId: &nexusclashv1.UUID{Value: userID}, Username: username}
+		payload, err := r.codec.Encode(ctx, event)
+		if err != nil {
+			return false, err
+		}
+		if err := r.outbox.Enqueue(ctx, tx, outbox.Message{Topic: r.topics.ProfileUpdated, Key: []byte(userID), Payload: payload}); err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return created > 0, nil
+}
+
+// AnonymizeProfile replaces the username of a deleted player with the one the auth service gives
+// deleted accounts: their whole ID behind a prefix players cannot choose, so no player can take it. If the profile does not exist yet, an anonymous
+// one is created, so that a registration event arriving late cannot bring back the old name.
+func (r *postgresRepository) AnonymizeProfile(ctx context.Context, userID string) error {
+	query := `
+		INSERT INTO profiles (user_id, username)
+		VALUES ($1, 'deleted_' || replace($1::text, '-', ''))
+		ON CONFLICT (user_id) DO UPDATE SET username = EXCLUDED.username;`
+
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "foreign_key_violation" {
+			return ErrUserNotFound
+		}
+		slog.Error("Failed to anonymize profile in database", "userID", userID, "error", err)
+		return err
+	}
+	return nil
+}
+
 // GetProfile retrieves a player profile from the database by user ID.
 func (r *postgresRepository) GetProfile(ctx context.Context, userID string) (*nexusclashv1.Profile, error) {
 	query := `
@@ -88,3 +192,92 @@ func (r *postgresRepository) GetProfile(ctx context.Context, userID string) (*ne
 	p.UserId = &nexusclashv1.UUID{Value: scannedUserID}
 	return p, nil
 }
+
+// UpdateProfile applies a partial update to a player profile and returns the updated profile.
+// A new username is announced with a profile_updated event, written to the outbox in the same
+// transaction, so that the auth service accepts it at login.
+func (r *postgresRepository) UpdateProfile(ctx context.Context, userID string, update ProfileUpdate) (*nexusclashv1.Profile, error) {
+	// Build the SET clause from the fields that are present, so that omitted fields keep their current value.
+	var setClauses []string
+	var args []interface{}
+	addColumn := func(column string, value interface{}) {
+		args = append(args, value)
+		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if update.Username != nil {
+		addColumn("username", *update.Username)
+	}
+	if update.Kills != nil {
+		addColumn("stats_kills", *update.Kills)
+	}
+	if update.Deaths != nil {
+		addColumn("stats_deaths", *update.Deaths)
+	}
+	if update.Assists != nil {
+		addColumn("stats_assists", *update.Assists)
+	}
+	if update.Wins != nil {
+		addColumn("stats_wins", *update.Wins)
+	}
+	if update.Losses != nil {
+		addColumn("stats_losses", *update.Losses)
+	}
+
+	if len(setClauses) == 0 {
+		return nil, ErrInvalidUpdate
+	}
+
+	args = append(args, userID)
+	query := fmt.Sprintf(`
+		UPDATE profiles
+		SET %s
+		WHERE user_id = $%d
+		RETURNING user_id, username, level, stats_kills, stats_deaths, stats_assists, stats_wins, stats_losses;
+	`, strings.Join(setClauses, ", "), len(args))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin profile update", "error", err)
+		return nil, err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	p := &nexusclashv1.Profile{Stats: &nexusclashv1.PlayerStats{}}
+	var scannedUserID string
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
+		&scannedUserID, &p.Username, &p.Level,
+		&p.Stats.Kills, &p.Stats.Deaths, &p.Stats.Assists, &p.Stats.Wins, &p.Stats.Losses,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrProfileNotFound
+		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return nil, ErrUsernameNotAvailable
+		}
+		slog.Error("Failed to update profile in database", "error", err)
+		return nil, err
+	}
+
+	if update.Username != nil {
+		event := &nexusclashv1.ProfileUpdatedEvent{UserId: &nexusclashv1.UUID{Value: scannedUserID}, Username: p.Username}
+		payload, err := r.codec.Encode(ctx, event)
+		if err != nil {
+			return nil, err
+		}
+		// Events are keyed by player, so the renames of one player stay in order.
+		if err := r.outbox.Enqueue(ctx, tx, outbox.Message{Topic: r.topics.ProfileUpdated, Key: []byte(scannedUserID), Payload: payload}); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	p.UserId = &nexusclashv1.UUID{Value: scannedUserID}
+	return p, nil
+}
@@ -3,6 +3,13 @@ package playerprofile
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/cheildo/nexus-clash-backend/internal/auth"
 
 	nexusclashv1 "github.com/cheildo/nexus-clash-backend/api/proto/nexusclash/v1"
 )
@@ -11,6 +18,9 @@ import (
 type Service interface {
 	CreateProfile(ctx context.Context, req *nexusclashv1.CreateProfileRequest) (*nexusclashv1.Profile, error)
 	GetProfile(ctx context.Context, req *nexusclashv1.GetProfileRequest) (*nexusclashv1.Profile, error)
+	UpdateProfile(ctx context.Context, req *nexusclashv1.UpdateProfileRequest) (*nexusclashv1.Profile, error)
+	EnsureProfile(ctx context.Context, userID, username string) error
+	AnonymizeProfile(ctx context.Context, userID string) error
 }
 
 type service struct {
@@ -26,11 +36,67 @@ func (s *service) CreateProfile(ctx context.Context, req *nexusclashv1.CreatePro
 	if req.GetUserId() == nil || req.GetUserId().GetValue() == "" {
 		return nil, errors.New("user_id is required")
 	}
-	if req.GetUsername() == "" {
-		return nil, errors.New("username is required")
+	username, err := auth.NormalizeChosenUsername(req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.CreateProfile(ctx, req.GetUserId().GetValue(), username)
+}
+
+// EnsureProfile creates the profile of a newly registered user, and does nothing if it already exists.
+// Both services reject names that only differ in case, so the username can only be taken if another
+// player renamed themselves to it before the auth service applied the rename. The profile is then
+// created under a fallback name with a suffix from the user ID, which is sent to the auth service
+// like a rename, so that both agree on it; the player can pick a new name later. If the fallback is
+// taken as well, ErrUsernameNotAvailable is returned.
+func (s *service) EnsureProfile(ctx context.Context, userID, username string) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return fmt.Errorf("%w: user ID %q is not a UUID", ErrInvalidProfile, userID)
+	}
+	// The name was accepted by the auth service, which also generates the names of guests.
+	username, err := auth.NormalizeUsername(username)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidProfile, err)
+	}
+
+	created, err := s.repo.CreateProfileIfMissing(ctx, userID, username, false)
+	if errors.Is(err, ErrUsernameNotAvailable) {
+		fallback := fallbackUsername(username, userID)
+		slog.Warn("Username of new user is taken by another profile", "userID", userID, "username", username, "fallback", fallback)
+		created, err = s.repo.CreateProfileIfMissing(ctx, userID, fallback, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	if created {
+		slog.Info("Profile created for new user", "userID", userID)
+	}
+	return nil
+}
+
+// fallbackUsername appends a suffix from the user ID to a username, shortening it to fit the column.
+func fallbackUsername(username, userID string) string {
+	suffix := "_" + strings.ReplaceAll(userID, "-", "")[:8]
+	if runes := []rune(username); len(runes)+len(suffix) > auth.MaxUsernameLength {
+		username = string(runes[:auth.MaxUsernameLength-len(suffix)])
+	}
+	return username + suffix
+}
+
+// AnonymizeProfile removes the personal data of a player who deleted their account. It can
+// safely be repeated for the same player.
+func (s *service) AnonymizeProfile(ctx context.Context, userID string) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return fmt.Errorf("%w: user ID %q is not a UUID", ErrInvalidProfile, userID)
 	}
 
-	return s.repo.CreateProfile(ctx, req.GetUserId().GetValue(), req.GetUsername())
+	if err := s.repo.AnonymizeProfile(ctx, userID); err != nil {
+		return err
+	}
+	slog.Info("Profile of deleted user anonymized", "userID", userID)
+	return nil
 }
 
 func (s *service) GetProfile(ctx context.Context, req *nexusclashv1.GetProfileRequest) (*nexusclashv1.Profile, error) {
@@ -40,3 +106,67 @@ func (s *service) GetProfile(ctx context.Context, req *nexusclashv1.GetProfileRe
 
 	return s.repo.GetProfile(ctx, req.GetUserId().GetValue())
 }
+
+// UpdateProfile applies the fields selected by the request's update mask.
+// An empty mask updates every field that is set in the request.
+func (s *service) UpdateProfile(ctx context.Context, req *nexusclashv1.UpdateProfileRequest) (*nexusclashv1.Profile, error) {
+	if req.GetUserId() == nil || req.GetUserId().GetValue() == "" {
+		return nil, fmt.Errorf("%w: user_id is required", ErrInvalidUpdate)
+	}
+
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		// No mask was given, so infer it from the populated fields.
+		if req.GetUsername() != "" {
+			paths = append(paths, "username")
+		}
+		if req.GetStats() != nil {
+			paths = append(paths, "stats")
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%w: no fields to update", ErrInvalidUpdate)
+	}
+
+	// Masked stats that are absent from the request are reset to their zero value.
+	stats := req.GetStats()
+	if stats == nil {
+		stats = &nexusclashv1.PlayerStats{}
+	}
+
+	var update ProfileUpdate
+	for _, path := range paths {
+		switch path {
+		case "username":
+			username, err := auth.NormalizeChosenUsername(req.GetUsername())
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidUpdate, err)
+			}
+			update.Username = &username
+		case "stats":
+			update.Kills, update.Deaths, update.Assists, update.Wins, update.Losses =
+				&stats.Kills, &stats.Deaths, &stats.Assists, &stats.Wins, &stats.Losses
+		case "stats.kills":
+			update.Kills = &stats.Kills
+		case "stats.deaths":
+			update.Deaths = &stats.Deaths
+		case "stats.assists":
+			update.Assists = &stats.Assists
+		case "stats.wins":
+			update.Wins = &stats.Wins
+		case "stats.losses":
+			update.Losses = &stats.Losses
+		default:
+			return nil, fmt.Errorf("%w: unknown field %q in update mask", ErrInvalidUpdate, path)
+		}
+	}
+
+	for _, value := range []*int32{update.Kills, update.Deaths, update.Assists, update.Wins, update.Losses} {
+		if value != nil && *value < 0 {
+			return nil, fmt.Errorf("%w: stats cannot be negative", ErrInvalidUpdate)
+		}
+	}
+
+	return s.repo.UpdateProfile(ctx, req.GetUserId().GetValue(), update)
+}
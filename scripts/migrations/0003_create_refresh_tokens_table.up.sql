@@ -0,0 +1,28 @@
+-- This table stores the long-lived refresh tokens issued alongside session tokens.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    -- 'user_id' links the token to its owner. Tokens are removed together with the user.
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- 'family_id' groups every token that descends from the same login through rotation.
+    -- If a rotated token is ever presented again, the whole family is revoked.
+    family_id UUID NOT NULL,
+
+    -- 'token_hash' is the hex-encoded SHA-256 of the opaque token. The token itself is never stored.
+    token_hash CHAR(64) UNIQUE NOT NULL,
+
+    expires_at TIMESTAMPTZ NOT NULL,
+
+    -- 'used_at' is set when the token is exchanged for a new one. A used token can never be exchanged again.
+    used_at TIMESTAMPTZ,
+
+    -- 'revoked_at' is set when the token (or its family) is revoked.
+    revoked_at TIMESTAMPTZ,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Indexes for revoking a whole family or all of a user's tokens.
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
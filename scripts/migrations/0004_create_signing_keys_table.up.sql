@@ -0,0 +1,22 @@
+-- This table stores the asymmetric key pairs used to sign session tokens.
+-- Keys are shared by every replica of the auth service and rotated on a schedule.
+CREATE TABLE IF NOT EXISTS signing_keys (
+    -- 'kid' is the key ID placed in the header of every token signed with the key.
+    kid VARCHAR(64) PRIMARY KEY,
+
+    -- 'algorithm' is the JWS algorithm of the key, e.g. 'EdDSA' or 'RS256'.
+    algorithm VARCHAR(16) NOT NULL,
+
+    -- 'private_key' is the PKCS#8 PEM encoding of the private key.
+    -- Access to this table must be restricted to the auth service.
+    private_key TEXT NOT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    -- 'sign_until' is when the key stops signing new tokens.
+    sign_until TIMESTAMPTZ NOT NULL,
+
+    -- 'verify_until' is when the key is removed from the JWKS. It must be later than
+    -- 'sign_until' by at least the lifetime of a token.
+    verify_until TIMESTAMPTZ NOT NULL
+);
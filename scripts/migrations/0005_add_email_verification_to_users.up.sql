@@ -0,0 +1,8 @@
+-- Tracks whether a user has proven ownership of their email address.
+-- Existing users start out unverified and can request a new verification email.
+ALTER TABLE users
+    -- 'email_verified' is set once the user opens the link from the verification email.
+    ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+
+    -- 'email_verified_at' records when the address was verified, for auditing.
+    ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
@@ -0,0 +1,36 @@
+-- This table stores the TOTP (RFC 6238) second factor of players who enabled two-factor authentication.
+CREATE TABLE IF NOT EXISTS user_totp (
+    -- A player has at most one authenticator. It is removed together with the user.
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+
+    -- 'secret' is the base32-encoded shared secret. Unlike passwords it cannot be hashed,
+    -- because the server needs it to compute the expected codes. Access must be restricted
+    -- to the auth service.
+    secret VARCHAR(64) NOT NULL,
+
+    -- 'confirmed_at' is set once the player has proven that their authenticator works.
+    -- Until then the enrollment is pending and Login does not ask for a code.
+    confirmed_at TIMESTAMPTZ,
+
+    -- 'last_used_step' is the time step of the last accepted code, so a code cannot be replayed.
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- This table stores the single-use recovery codes that replace a lost authenticator.
+CREATE TABLE IF NOT EXISTS totp_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- 'code_hash' is the hex-encoded SHA-256 of the normalized code. The code itself is never stored.
+    code_hash CHAR(64) NOT NULL,
+
+    -- 'used_at' is set when the code is redeemed. A used code can never be redeemed again.
+    used_at TIMESTAMPTZ,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    UNIQUE (user_id, code_hash)
+);
@@ -0,0 +1,27 @@
+-- This table links accounts at external identity providers (OAuth2/OIDC) to users.
+CREATE TABLE IF NOT EXISTS identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    -- 'user_id' is the local account the identity signs in to. Links are removed together with the user.
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- 'provider' is the name of the provider in the auth service configuration, e.g. 'google'.
+    provider VARCHAR(64) NOT NULL,
+
+    -- 'subject' is the provider's stable user ID (the 'sub' claim of the ID token).
+    -- Emails can change or be reassigned at the provider, so they are never used to look up identities.
+    subject VARCHAR(255) NOT NULL,
+
+    -- 'email' is the address reported by the provider when the identity was linked, for display only.
+    email VARCHAR(255),
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    -- A provider account signs in to exactly one user.
+    CONSTRAINT identities_provider_subject_key UNIQUE (provider, subject),
+    -- A user links at most one account per provider.
+    CONSTRAINT identities_user_provider_key UNIQUE (user_id, provider)
+);
+
+-- Players who only ever signed in through a provider have no password.
+ALTER TABLE users ALTER COLUMN password_hash DROP NOT NULL;
@@ -0,0 +1,13 @@
+-- Guest accounts let new players start playing without registering.
+-- A guest signs in with a random device secret kept by their client, and can later be upgraded
+-- to a full account in place, so the user ID, and with it the profile and stats, is kept.
+
+-- 'is_guest' is true until the guest is upgraded with an email and password.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_guest BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- 'device_secret_hash' is the SHA-256 of the guest's device secret. It is cleared on upgrade.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS device_secret_hash VARCHAR(64);
+
+-- Guests have no email address until they are upgraded. Everyone else still needs one.
+ALTER TABLE users ALTER COLUMN email DROP NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_email_required_check CHECK (is_guest OR email IS NOT NULL);
@@ -0,0 +1,26 @@
+-- Roles grant staff privileges on top of a regular player account.
+-- Players without any role are ordinary players.
+CREATE TABLE IF NOT EXISTS roles (
+    -- 'name' is the identifier carried in the "roles" claim of session tokens.
+    name VARCHAR(32) PRIMARY KEY,
+    description TEXT NOT NULL
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('moderator', 'Can view any player and sanction accounts.'),
+    ('admin', 'Can do everything a moderator can, edit player stats and grant roles.')
+ON CONFLICT (name) DO NOTHING;
+
+-- This table assigns roles to users.
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(32) NOT NULL REFERENCES roles(name),
+
+    -- 'granted_by' is the admin who granted the role. It is NULL for roles assigned directly in the
+    -- database, which is how the first admin is created:
+    --   INSERT INTO user_roles (user_id, role) VALUES ('<user id>', 'admin');
+    granted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    granted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (user_id, role)
+);
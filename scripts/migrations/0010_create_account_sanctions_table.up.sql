@@ -0,0 +1,30 @@
+-- This table records bans and suspensions issued by staff. Rows are never deleted, so the
+-- history of an account's sanctions is kept; lifting a sanction only sets 'lifted_at'.
+CREATE TABLE IF NOT EXISTS account_sanctions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- 'type' is 'ban' for permanent sanctions and 'suspension' for ones with an expiry.
+    type VARCHAR(16) NOT NULL CHECK (type IN ('ban', 'suspension')),
+
+    -- 'reason' is shown to the player when they try to sign in.
+    reason TEXT NOT NULL,
+
+    -- 'issued_by' is the moderator or admin who issued the sanction.
+    issued_by UUID REFERENCES users(id) ON DELETE SET NULL,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    -- 'expires_at' is NULL for permanent bans.
+    expires_at TIMESTAMPTZ,
+
+    -- 'lifted_at' and 'lifted_by' are set when staff lift the sanction before it expires.
+    lifted_at TIMESTAMPTZ,
+    lifted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+
+    CONSTRAINT account_sanctions_expiry_check CHECK ((type = 'ban') = (expires_at IS NULL))
+);
+
+-- Every login and refresh looks up the sanctions of the account that have not been lifted.
+CREATE INDEX IF NOT EXISTS idx_account_sanctions_user_id ON account_sanctions (user_id) WHERE lifted_at IS NULL;
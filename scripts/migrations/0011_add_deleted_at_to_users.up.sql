@@ -0,0 +1,12 @@
+-- Deleted accounts are anonymized right away and removed for good after a grace period,
+-- during which the row (and e.g. its sanctions) is kept for abuse investigations.
+-- 'deleted_at' is set when the player deletes their account. The purge job hard-deletes rows
+-- whose grace period has passed; the profile and everything else cascades with them.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Anonymized accounts have no email address.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_required_check;
+ALTER TABLE users ADD CONSTRAINT users_email_required_check CHECK (is_guest OR deleted_at IS NOT NULL OR email IS NOT NULL);
+
+-- The purge job looks up accounts by deletion time.
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;
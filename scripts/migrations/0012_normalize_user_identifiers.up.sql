@@ -0,0 +1,33 @@
+-- Players sign in with their email address or their username, both case-insensitively.
+
+-- Emails are stored in lowercase, so that the plain unique constraint also rejects addresses that
+-- only differ in case. Existing rows are normalized first; if two accounts only differ in the case
+-- of their email, this fails and they have to be merged by hand.
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
+UPDATE identities SET email = lower(email) WHERE email <> lower(email);
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_lowercase_check;
+ALTER TABLE users ADD CONSTRAINT users_email_lowercase_check CHECK (email = lower(email));
+
+-- Usernames keep the case the player chose for display, but "Alice" and "alice" are the same player.
+-- The functional index enforces that and serves lookups by lower(username). It cannot be created
+-- while two accounts only differ in the case of their username. Those are listed, and one of each
+-- has to be renamed by hand before the migration is run again.
+DO $$
+DECLARE
+    conflicts TEXT;
+BEGIN
+    SELECT string_agg(names, '; ') INTO conflicts
+    FROM (
+        SELECT string_agg(username || ' (' || id || ')', ', ' ORDER BY username) AS names
+        FROM users
+        GROUP BY lower(username)
+        HAVING count(*) > 1
+    ) AS duplicates;
+
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'usernames only differing in case must be renamed first: %', conflicts;
+    END IF;
+END
+$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_lower_key ON users (lower(username));
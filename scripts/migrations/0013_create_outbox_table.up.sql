@@ -0,0 +1,10 @@
+-- The transactional outbox holds events that are written in the same transaction as the change
+-- they announce, e.g. user_registered with the new users row. A relay publishes them to Kafka
+-- in 'id' order and deletes them once the broker has acknowledged them.
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    topic VARCHAR(255) NOT NULL,
+    key BYTEA,
+    payload BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
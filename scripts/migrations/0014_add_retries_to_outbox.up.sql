@@ -0,0 +1,8 @@
+-- The outbox relay retries failed publishes with backoff instead of blocking on them.
+-- 'attempts' counts the failed publishes. 'next_attempt_at' is when the message is due: the relay
+-- moves it forward when it claims a message (a lease against other relays) and when a publish fails.
+ALTER TABLE outbox
+    ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_outbox_next_attempt_at ON outbox (next_attempt_at);
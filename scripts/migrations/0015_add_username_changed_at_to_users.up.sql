@@ -0,0 +1,4 @@
+-- Players rename themselves in the player-profile service, which announces the new name with a
+-- profile_updated event. 'username_changed_at' is when the applied rename happened, so that a
+-- redelivered or delayed event cannot bring back an older name.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_changed_at TIMESTAMPTZ;
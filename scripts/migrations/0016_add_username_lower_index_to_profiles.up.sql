@@ -0,0 +1,25 @@
+-- Profiles enforce the same rule for usernames as the users table (0012): "Alice" and "alice" are
+-- the same name. Otherwise the player-profile service could accept a rename that the auth service
+-- cannot apply, and the two would disagree about the name of the player.
+
+-- The index cannot be created while two profiles only differ in the case of their username. They
+-- are listed, and have to be renamed by hand before the migration is run again.
+DO $$
+DECLARE
+    conflicts TEXT;
+BEGIN
+    SELECT string_agg(names, '; ') INTO conflicts
+    FROM (
+        SELECT string_agg(username, ', ' ORDER BY username) AS names
+        FROM profiles
+        GROUP BY lower(username)
+        HAVING count(*) > 1
+    ) AS duplicates;
+
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'profile usernames only differing in case must be renamed first: %', conflicts;
+    END IF;
+END
+$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS profiles_username_lower_key ON profiles (lower(username));